@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+)
+
+// runBackfill reads the statistics history of a cluster and writes it as
+// OpenMetrics, ready for promtool tsdb create-blocks-from openmetrics.
+func runBackfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	target := fs.String("target", "", "Address of the cluster, defaults to the host of -url")
+	start := fs.String("start", "", "Start of the time range, RFC 3339 or unix time")
+	end := fs.String("end", "", "End of the time range, RFC 3339 or unix time (default now)")
+	interval := fs.Duration("interval", time.Minute, "Time between two samples")
+	output := fs.String("output", "-", "File to write the OpenMetrics to, - for stdout")
+	fs.Parse(args)
+
+	address, err := commandTarget(*target)
+	if err != nil {
+		return err
+	}
+	if *start == "" {
+		return errors.New("backfill needs a -start time")
+	}
+	begin, err := parseTime(*start)
+	if err != nil {
+		return err
+	}
+	until := time.Now()
+	if *end != "" {
+		if until, err = parseTime(*end); err != nil {
+			return err
+		}
+	}
+	if !begin.Before(until) {
+		return errors.New("backfill -start must be before -end")
+	}
+	if *interval < time.Second {
+		return errors.New("backfill -interval must be at least 1s")
+	}
+
+	log.Info("Connecting to Isilon Cluster: " + address)
+	c, err := isiclient.NewIsiClient(currentConfig().ISI.Credentials, address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to Isilon: %s", err)
+	}
+	cluster := currentConfig().Cluster(c.ClusterName, c.ClusterAddress)
+
+	log.Infof("Reading statistics history of %s from %s to %s", c.ClusterName, begin.Format(time.RFC3339), until.Format(time.RFC3339))
+	families, err := collector.History(c, cluster.Statistics, begin, until, *interval)
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return writeOpenMetrics(os.Stdout, families)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := writeOpenMetrics(f, families); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// commandTarget returns the cluster a command runs against: the given target,
+// or the host of -url when there is none.
+func commandTarget(target string) (string, error) {
+	if target != "" {
+		return target, nil
+	}
+	u, err := url.Parse(currentConfig().ISI.IsiURL)
+	if err != nil {
+		return "", fmt.Errorf("issue with Isilon URL: %s", err)
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("no cluster given, use -target or -url")
+	}
+	return u.Hostname(), nil
+}
+
+// parseTime reads a time given in RFC 3339 or as unix time
+func parseTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or unix time", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Plugin states of the check command, which are also its exit codes
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkSeverity orders the plugin states from least to most severe
+var checkSeverity = map[int]int{checkOK: 0, checkUnknown: 1, checkWarning: 2, checkCritical: 3}
+
+// checkResult is the outcome of a single check
+type checkResult struct {
+	state    int
+	message  string
+	perfdata []string
+}
+
+// checkThresholds are the thresholds given on the command line
+type checkThresholds struct {
+	spaceWarning, spaceCritical   float64
+	eventsWarning, eventsCritical string
+	synciqWarning, synciqCritical time.Duration
+}
+
+// clusterCheck evaluates the metrics of the collector it needs
+type clusterCheck struct {
+	collector string
+	evaluate  func(m checkMetrics, t checkThresholds) checkResult
+}
+
+// clusterChecks are the checks the check command can run
+var clusterChecks = map[string]clusterCheck{
+	"space":  {"cluster", checkSpace},
+	"events": {"event", checkEvents},
+	"health": {"health", checkHealth},
+	"drives": {"drive", checkDrives},
+	"synciq": {"synciq", checkSyncIQ},
+}
+
+// runCheck runs the selected checks against a cluster as a Nagios or Icinga
+// plugin. It prints the plugin output and returns its exit code.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	target := fs.String("target", "", "Address of the cluster, defaults to the host of -url")
+	checks := fs.String("checks", "space,events,health", "Comma separated list of checks to run")
+	var t checkThresholds
+	fs.Float64Var(&t.spaceWarning, "space-warning", 20, "Warn when less than this percentage of /ifs is available")
+	fs.Float64Var(&t.spaceCritical, "space-critical", 10, "Critical when less than this percentage of /ifs is available")
+	fs.StringVar(&t.eventsWarning, "events-warning", "error", "Warn on unresolved events of this severity or worse, none to disable")
+	fs.StringVar(&t.eventsCritical, "events-critical", "critical", "Critical on unresolved events of this severity or worse, none to disable")
+	fs.DurationVar(&t.synciqWarning, "synciq-warning", 24*time.Hour, "Warn when an enabled SyncIQ policy last succeeded longer ago than this")
+	fs.DurationVar(&t.synciqCritical, "synciq-critical", 48*time.Hour, "Critical when an enabled SyncIQ policy last succeeded longer ago than this")
+	if err := fs.Parse(args); err != nil {
+		return checkFailed(err)
+	}
+
+	var selected []string
+	for _, name := range strings.Split(*checks, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := clusterChecks[name]; !ok {
+			return checkFailed(fmt.Errorf("unknown check %q", name))
+		}
+		selected = append(selected, name)
+	}
+	for _, s := range []string{t.eventsWarning, t.eventsCritical} {
+		if !validSeverity(s) {
+			return checkFailed(fmt.Errorf("unknown event severity %q", s))
+		}
+	}
+	address, err := commandTarget(*target)
+	if err != nil {
+		return checkFailed(err)
+	}
+
+	c, err := isiclient.NewIsiClient(currentConfig().ISI.Credentials, address)
+	if err != nil {
+		return checkFailed(fmt.Errorf("unable to connect to Isilon: %s", err))
+	}
+	families, err := gatherChecks(c, selected)
+	if err != nil {
+		return checkFailed(err)
+	}
+
+	m := checkMetrics{}
+	for _, mf := range families {
+		m[mf.GetName()] = mf
+	}
+	state := checkOK
+	var messages, perfdata []string
+	for _, name := range selected {
+		cc := clusterChecks[name]
+		result := cc.evaluate(m, t)
+		if !m.succeeded(cc.collector) {
+			result = checkResult{state: checkUnknown, message: cc.collector + " collector failed"}
+		}
+		if checkSeverity[result.state] > checkSeverity[state] {
+			state = result.state
+		}
+		messages = append(messages, name+": "+result.message)
+		perfdata = append(perfdata, result.perfdata...)
+	}
+
+	output := fmt.Sprintf("ISILON %s - %s: %s", checkStateNames[state], c.ClusterName, strings.Join(messages, ", "))
+	if len(perfdata) > 0 {
+		output += " | " + strings.Join(perfdata, " ")
+	}
+	fmt.Println(output)
+	return state
+}
+
+// checkFailed prints the plugin output of a check that could not run
+func checkFailed(err error) int {
+	fmt.Printf("ISILON UNKNOWN - %s\n", err)
+	return checkUnknown
+}
+
+// validSeverity reports if s is a OneFS event severity or none
+func validSeverity(s string) bool {
+	return s == "none" || collector.RankSeverity(s) < collector.RankSeverity("")
+}
+
+// gatherChecks collects the metrics of the collectors the selected checks need
+func gatherChecks(c *isiclient.ISIClient, selected []string) ([]*dto.MetricFamily, error) {
+	needed := map[string]bool{}
+	for _, name := range selected {
+		needed[clusterChecks[name].collector] = true
+	}
+	// the optional collectors only run for the checks naming them
+	collectors, err := newCollectorsWith(currentConfig(), c, isiconfig.CollectorsConfig{SyncIQ: needed["synciq"], Drives: needed["drive"]})
+	if err != nil {
+		return nil, fmt.Errorf("can't create exporter: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	for _, nc := range collectors {
+		if !needed[nc.name] {
+			continue
+		}
+		if err := registry.Register(nc.Collector); err != nil {
+			return nil, err
+		}
+	}
+	return registry.Gather()
+}
+
+// checkMetrics holds the gathered metric families by name
+type checkMetrics map[string]*dto.MetricFamily
+
+// samples returns the samples of a metric
+func (m checkMetrics) samples(name string) []*dto.Metric {
+	if mf, ok := m[name]; ok {
+		return mf.Metric
+	}
+	return nil
+}
+
+// value returns the value of a metric with a single sample
+func (m checkMetrics) value(name string) (float64, bool) {
+	samples := m.samples(name)
+	if len(samples) != 1 {
+		return 0, false
+	}
+	return samples[0].GetGauge().GetValue(), true
+}
+
+// succeeded reports if the collector delivered its metrics
+func (m checkMetrics) succeeded(collector string) bool {
+	name := "emcisi_" + collector + "_scrape_success"
+	if collector == "cluster" {
+		name = "emcisi_exporter_up"
+	}
+	up, ok := m.value(name)
+	return ok && up == 1
+}
+
+// label returns the value of a label of a sample
+func label(s *dto.Metric, name string) string {
+	for _, l := range s.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// checkSpace checks the share of /ifs still available
+func checkSpace(m checkMetrics, t checkThresholds) checkResult {
+	avail, ok := m.value("emcisi_cluster_ifs_bytes_avail")
+	total, ok2 := m.value("emcisi_cluster_ifs_bytes_total")
+	if !ok || !ok2 || total == 0 {
+		return checkResult{state: checkUnknown, message: "no /ifs usage reported"}
+	}
+	percent := avail / total * 100
+	r := checkResult{
+		message: fmt.Sprintf("%.1f%% of /ifs available", percent),
+		perfdata: []string{
+			fmt.Sprintf("ifs_avail=%.2f%%;%g:;%g:;0;100", percent, t.spaceWarning, t.spaceCritical),
+			fmt.Sprintf("ifs_avail_bytes=%.0fB;;;0;%.0f", avail, total),
+		},
+	}
+	switch {
+	case percent < t.spaceCritical:
+		r.state = checkCritical
+	case percent < t.spaceWarning:
+		r.state = checkWarning
+	}
+	return r
+}
+
+// checkEvents checks the severity of the unresolved events
+func checkEvents(m checkMetrics, t checkThresholds) checkResult {
+	counts := map[string]float64{}
+	for _, s := range m.samples("emcisi_event_groups") {
+		counts[label(s, "severity")] += s.GetGauge().GetValue()
+	}
+	severities := make([]string, 0, len(counts))
+	for severity := range counts {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		return collector.RankSeverity(severities[i]) < collector.RankSeverity(severities[j])
+	})
+
+	r := checkResult{message: "no unresolved events"}
+	var parts []string
+	for _, severity := range severities {
+		parts = append(parts, fmt.Sprintf("%.0f %s", counts[severity], severity))
+		rank := collector.RankSeverity(severity)
+		switch {
+		case t.eventsCritical != "none" && rank <= collector.RankSeverity(t.eventsCritical):
+			r.state = checkCritical
+		case t.eventsWarning != "none" && rank <= collector.RankSeverity(t.eventsWarning) && r.state != checkCritical:
+			r.state = checkWarning
+		}
+	}
+	if len(parts) > 0 {
+		r.message = strings.Join(parts, ", ") + " unresolved events"
+	}
+	for _, severity := range []string{"emergency", "critical", "error", "warning", "information"} {
+		r.perfdata = append(r.perfdata, fmt.Sprintf("events_%s=%.0f", severity, counts[severity]))
+	}
+	return r
+}
+
+// checkHealth checks the quorum and the health of the cluster and its nodes
+func checkHealth(m checkMetrics, t checkThresholds) checkResult {
+	healthy, ok := m.value("emcisi_health_cluster_healthy")
+	quorate, ok2 := m.value("emcisi_health_cluster_quorate")
+	if !ok || !ok2 {
+		return checkResult{state: checkUnknown, message: "no cluster status reported"}
+	}
+	var unhealthy []string
+	for _, s := range m.samples("emcisi_health_node_healthy") {
+		if s.GetGauge().GetValue() == 0 {
+			unhealthy = append(unhealthy, label(s, "node"))
+		}
+	}
+	sort.Strings(unhealthy)
+
+	r := checkResult{
+		message:  "cluster healthy",
+		perfdata: []string{fmt.Sprintf("nodes_unhealthy=%d;0;;0;%d", len(unhealthy), len(m.samples("emcisi_health_node_healthy")))},
+	}
+	switch {
+	case quorate == 0:
+		r.state, r.message = checkCritical, "cluster has no quorum"
+	case healthy == 0 || len(unhealthy) > 0:
+		r.state, r.message = checkWarning, "cluster not healthy"
+	}
+	if len(unhealthy) > 0 {
+		r.message += ", nodes not healthy: " + strings.Join(unhealthy, " ")
+	}
+	return r
+}
+
+// checkDrives checks that every drive is healthy
+func checkDrives(m checkMetrics, t checkThresholds) checkResult {
+	states := map[string]string{}
+	for _, s := range m.samples("emcisi_drive_status") {
+		states[label(s, "node")+"/"+label(s, "bay")] = label(s, "state")
+	}
+	drives := m.samples("emcisi_drive_healthy")
+	var unhealthy []string
+	for _, s := range drives {
+		if s.GetGauge().GetValue() == 0 {
+			drive := label(s, "node") + "/" + label(s, "bay")
+			unhealthy = append(unhealthy, drive+" "+states[drive])
+		}
+	}
+	sort.Strings(unhealthy)
+
+	r := checkResult{
+		message:  fmt.Sprintf("%d drives healthy", len(drives)),
+		perfdata: []string{fmt.Sprintf("drives_unhealthy=%d;;0;0;%d", len(unhealthy), len(drives))},
+	}
+	if len(unhealthy) > 0 {
+		r.state = checkCritical
+		r.message = "drives not healthy: " + strings.Join(unhealthy, ", ")
+	}
+	return r
+}
+
+// checkSyncIQ checks the time since the last success of every enabled policy
+func checkSyncIQ(m checkMetrics, t checkThresholds) checkResult {
+	lastSuccess := map[string]float64{}
+	for _, s := range m.samples("emcisi_synciq_policy_last_success_timestamp_seconds") {
+		lastSuccess[label(s, "policy")] = s.GetGauge().GetValue()
+	}
+
+	r := checkResult{}
+	var enabled int
+	var maxLag time.Duration
+	var late []string
+	now := time.Now()
+	for _, s := range m.samples("emcisi_synciq_policy_enabled") {
+		if s.GetGauge().GetValue() == 0 {
+			continue
+		}
+		enabled++
+		policy := label(s, "policy")
+		last, ok := lastSuccess[policy]
+		if !ok {
+			late = append(late, policy+" never succeeded")
+			if r.state != checkCritical {
+				r.state = checkWarning
+			}
+			continue
+		}
+		lag := now.Sub(time.Unix(int64(last), 0))
+		if lag > maxLag {
+			maxLag = lag
+		}
+		switch {
+		case lag > t.synciqCritical:
+			r.state = checkCritical
+		case lag > t.synciqWarning:
+			if r.state != checkCritical {
+				r.state = checkWarning
+			}
+		default:
+			continue
+		}
+		late = append(late, fmt.Sprintf("%s last succeeded %s ago", policy, lag.Round(time.Minute)))
+	}
+	sort.Strings(late)
+
+	r.message = fmt.Sprintf("%d enabled policies in time", enabled)
+	if len(late) > 0 {
+		r.message = strings.Join(late, ", ")
+	}
+	r.perfdata = []string{fmt.Sprintf("synciq_max_lag=%.0fs;%.0f;%.0f;0", maxLag.Seconds(), t.synciqWarning.Seconds(), t.synciqCritical.Seconds())}
+	return r
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// writeOpenMetrics writes metric families in the OpenMetrics text format,
+// including the timestamps of the samples, and terminates them with # EOF.
+func writeOpenMetrics(out io.Writer, families []*dto.MetricFamily) error {
+	w := bufio.NewWriter(out)
+	for _, mf := range families {
+		name := mf.GetName()
+		family, typ := name, "unknown"
+		switch mf.GetType() {
+		case dto.MetricType_GAUGE:
+			typ = "gauge"
+		case dto.MetricType_COUNTER:
+			// OpenMetrics counters need the _total suffix, keep other counters untyped
+			// so their name does not change
+			if strings.HasSuffix(name, "_total") {
+				family, typ = strings.TrimSuffix(name, "_total"), "counter"
+			}
+		case dto.MetricType_SUMMARY:
+			typ = "summary"
+		case dto.MetricType_HISTOGRAM:
+			typ = "histogram"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", family, typ)
+		if mf.GetHelp() != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", family, escapeOpenMetrics(mf.GetHelp()))
+		}
+
+		metrics := append([]*dto.Metric(nil), mf.Metric...)
+		sort.SliceStable(metrics, func(i, j int) bool {
+			li, lj := labelString(metrics[i].Label, "", ""), labelString(metrics[j].Label, "", "")
+			if li != lj {
+				return li < lj
+			}
+			return metrics[i].GetTimestampMs() < metrics[j].GetTimestampMs()
+		})
+		for _, m := range metrics {
+			switch mf.GetType() {
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.Summary.Quantile {
+					writeSample(w, name, m, "quantile", formatFloat(q.GetQuantile()), q.GetValue())
+				}
+				writeSample(w, name+"_sum", m, "", "", m.Summary.GetSampleSum())
+				writeSample(w, name+"_count", m, "", "", float64(m.Summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				for _, b := range m.Histogram.Bucket {
+					writeSample(w, name+"_bucket", m, "le", formatFloat(b.GetUpperBound()), float64(b.GetCumulativeCount()))
+				}
+				writeSample(w, name+"_bucket", m, "le", "+Inf", float64(m.Histogram.GetSampleCount()))
+				writeSample(w, name+"_sum", m, "", "", m.Histogram.GetSampleSum())
+				writeSample(w, name+"_count", m, "", "", float64(m.Histogram.GetSampleCount()))
+			case dto.MetricType_GAUGE:
+				writeSample(w, name, m, "", "", m.Gauge.GetValue())
+			case dto.MetricType_COUNTER:
+				writeSample(w, name, m, "", "", m.Counter.GetValue())
+			default:
+				writeSample(w, name, m, "", "", m.Untyped.GetValue())
+			}
+		}
+	}
+	fmt.Fprint(w, "# EOF\n")
+	return w.Flush()
+}
+
+// writeSample writes a single sample line, with an optional extra label
+func writeSample(w io.Writer, name string, m *dto.Metric, extraName, extraValue string, value float64) {
+	fmt.Fprintf(w, "%s%s %s", name, labelString(m.Label, extraName, extraValue), formatFloat(value))
+	if m.TimestampMs != nil {
+		fmt.Fprintf(w, " %s", strconv.FormatFloat(float64(m.GetTimestampMs())/1000, 'f', -1, 64))
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// labelString formats the labels of a sample as {name="value",...}
+func labelString(labels []*dto.LabelPair, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)+1)
+	for _, l := range labels {
+		pairs = append(pairs, l.GetName()+`="`+escapeOpenMetrics(l.GetValue())+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeOpenMetrics(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeOpenMetrics escapes label values and help texts
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+// formatFloat formats a sample value
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -5,18 +5,35 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jamiealquiza/envy"
 	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
 	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/influx"
 	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/poller"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/web"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,7 +43,6 @@ const (
 
 var (
 	log        = logrus.New()
-	config     *isiconfig.Config
 	debugLevel = flag.Bool("debug", false, "enable debug messages")
 
 	// date is a time label of the moment when the binary was built
@@ -44,16 +60,29 @@ var (
 		},
 		[]string{"version", "commitid", "goversion"},
 	)
-	isiExporterUp = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "emcisi_exporter_up",
-			Help: "Indicates if scrape was successful or not.",
+	isiQueryRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "emcisi_query_rejected_total",
+			Help: "Number of queries rejected because of their target, by reason.",
 		},
-		[]string{"clustername"},
+		[]string{"reason"},
 	)
 )
 
+// validTarget matches hostnames, so a target can not add a port, path or user
+// to the URLs it is put in
+var validTarget = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
 func init() {
+	isiCollectionBuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+	prometheus.MustRegister(isiCollectionBuildInfo)
+	prometheus.MustRegister(isiQueryRejected)
+	prometheus.MustRegister(isiclient.Metrics)
+}
+
+// setup reads the flags and the configuration. It is not part of init so the
+// tests do not parse the flags of the test binary.
+func setup() {
 	log.Formatter = new(logrus.TextFormatter)
 	envy.Parse("ISIENV") // looks for ISIENV_USERNAME, ISIENV_PASSWORD, ISIENV_BINDPORT etc
 	flag.Parse()
@@ -66,52 +95,497 @@ func init() {
 		log.Level = logrus.InfoLevel
 	}
 
-	//
-	isiCollectionBuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
-	prometheus.MustRegister(isiCollectionBuildInfo)
-
 	// gather our configuration
-	config = isiconfig.GetConfig()
+	cfg, err := isiconfig.GetConfig()
+	if err != nil {
+		log.Fatalf("Unable to load configuration: %s", err)
+	}
+	currentCfg.Store(cfg)
+}
+
+// namedCollector is a cluster collector along with the name used to configure it
+type namedCollector struct {
+	name string
+	prometheus.Collector
+}
+
+// newCollectors creates every cluster collector for the given client with the
+// settings of the cluster in cfg.
+func newCollectors(cfg *isiconfig.Config, c *isiclient.ISIClient) ([]namedCollector, error) {
+	return newCollectorsWith(cfg, c, *cfg.Cluster(c.ClusterName, c.ClusterAddress).Collectors)
+}
+
+// newCollectorsWith creates the cluster collectors for the given client with
+// the settings of the cluster in cfg and the given optional collectors.
+func newCollectorsWith(cfg *isiconfig.Config, c *isiclient.ISIClient, optional isiconfig.CollectorsConfig) ([]namedCollector, error) {
+	cluster := cfg.Cluster(c.ClusterName, c.ClusterAddress)
+
+	// cluster summary info
+	clusterSummaryExporter, err := collector.NewIsiClusterCollector(c, namespace, cfg.Exporter.RateGauges)
+	if err != nil {
+		return nil, err
+	}
+
+	// cluster and node health, quorum and time skew
+	healthExporter, err := collector.NewIsiHealthCollector(c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// OneFS upgrade and patch status
+	upgradeExporter, err := collector.NewIsiUpgradeCollector(c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// dedupe and data reduction savings
+	dedupeExporter, err := collector.NewIsiDedupeCollector(c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// quota thresholds and usage
+	quotaExporter, err := collector.NewIsiQuotaCollector(c, namespace, *cluster.Quota)
+	if err != nil {
+		return nil, err
+	}
+
+	// unresolved events
+	eventExporter, err := collector.NewIsiEventCollector(c, namespace, *cluster.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	collectors := []namedCollector{
+		{"cluster", clusterSummaryExporter},
+		{"health", healthExporter},
+		{"upgrade", upgradeExporter},
+		{"dedupe", dedupeExporter},
+		{"quota", quotaExporter},
+		{"event", eventExporter},
+	}
+
+	// SyncIQ replication policies
+	if optional.SyncIQ {
+		synciqExporter, err := collector.NewIsiSyncIQCollector(c, namespace)
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, namedCollector{"synciq", synciqExporter})
+	}
+
+	// drive state and health
+	if optional.Drives {
+		driveExporter, err := collector.NewIsiDriveCollector(c, namespace)
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, namedCollector{"drive", driveExporter})
+	}
+
+	// statistics keys listed in the configuration file
+	if len(cluster.Statistics) > 0 {
+		statisticsExporter, err := collector.NewIsiStatisticsCollector(c, namespace, cluster.Statistics)
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, namedCollector{"statistics", statisticsExporter})
+	}
+	return collectors, nil
+}
+
+// registerCollectors creates every cluster collector for the given client and
+// registers them with the registerer.
+func registerCollectors(cfg *isiconfig.Config, registry prometheus.Registerer, c *isiclient.ISIClient) error {
+	collectors, err := newCollectors(cfg, c)
+	if err != nil {
+		return err
+	}
+	for _, nc := range collectors {
+		log.Debugf("Register %s exporter", nc.name)
+		if err := registry.Register(nc.Collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// polledCollectors returns the function creating the cluster collectors for
+// the background poller, each with the polling interval configured for the
+// cluster in cfg.
+func polledCollectors(cfg *isiconfig.Config) poller.CollectorsFunc {
+	return func(c *isiclient.ISIClient) ([]poller.Collector, error) {
+		collectors, err := newCollectors(cfg, c)
+		if err != nil {
+			return nil, err
+		}
+		polling := cfg.Cluster(c.ClusterName, c.ClusterAddress).Polling
+		polled := make([]poller.Collector, 0, len(collectors))
+		for _, nc := range collectors {
+			polled = append(polled, poller.Collector{Name: nc.name, Collector: nc.Collector, Interval: polling.IntervalOf(nc.name)})
+		}
+		return polled, nil
+	}
+}
+
+// pushGatherer returns the gatherer of a pushed cluster: the latest results of
+// the poller when the cluster is polled, otherwise its collectors.
+func (s *service) pushGatherer(target string) (prometheus.Gatherer, error) {
+	if g := s.polledGatherer(target); g != nil {
+		return g, nil
+	}
+	c, err := isiclient.NewIsiClient(currentCredentials{}, target)
+	if err != nil {
+		return nil, err
+	}
+	return s.clusterGatherer(c)
+}
+
+// clusterGatherer returns the gatherer of a connected cluster: the latest
+// results of the poller when the cluster is polled, otherwise its collectors.
+func (s *service) clusterGatherer(c *isiclient.ISIClient) (prometheus.Gatherer, error) {
+	if g := s.polledGatherer(c.ClusterAddress); g != nil {
+		return g, nil
+	}
+	registry := prometheus.NewRegistry()
+	if err := registerCollectors(s.config, registry, c); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// polledGatherer returns a gatherer of the latest results of a polled
+// cluster, or nil if the cluster is not polled.
+func (s *service) polledGatherer(target string) prometheus.Gatherer {
+	polled := s.polledCollector(target)
+	if polled == nil {
+		return nil
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(polled)
+	return registry
+}
+
+// polledCollector returns the collector serving the latest results of a polled
+// cluster, or nil if the cluster is not polled.
+func (s *service) polledCollector(target string) prometheus.Collector {
+	if s == nil || s.poller == nil {
+		return nil
+	}
+	return s.poller.Collector(target)
 }
 
 func queryHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := queryTarget(w, r)
+	if !ok {
+		return
+	}
+
+	registry, c := targetRegistry(target)
+	defer c.Close()
+
+	// Delegate http serving to Prometheus client library, which will call collector.Collect.
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+}
+
+// influxQueryHandler serves a cluster scrape in the InfluxDB line protocol
+func influxQueryHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := queryTarget(w, r)
+	if !ok {
+		return
+	}
+	registry, c := targetRegistry(target)
+	defer c.Close()
+	serveInflux(w, registry)
+}
+
+// queryTarget returns the address to connect to for the target of a query, or
+// answers the query with an error if the target is missing or not allowed. The cluster credentials are sent to
+// the target, so only configured clusters and allowlisted targets are accepted.
+func queryTarget(w http.ResponseWriter, r *http.Request) (string, bool) {
 	target := r.URL.Query().Get("target")
-	if target == "" {
+	reason := ""
+	switch {
+	case target == "":
+		isiQueryRejected.WithLabelValues("missing").Inc()
 		http.Error(w, "'target' parameter must be specified", 400)
-		return
+		return "", false
+	case net.ParseIP(target) == nil && !validTarget.MatchString(target):
+		reason = "invalid"
+	case strings.Contains(target, ":"):
+		// IPv6 addresses, the clients build their URLs without brackets
+		reason = "invalid"
+	case !currentConfig().TargetAllowed(target):
+		reason = "not_allowed"
+	default:
+		// Never resolve the name of a configured cluster, connect to its address
+		return currentConfig().TargetAddress(target), true
 	}
+	log.Infof("Rejected query for target %q from %s: %s", target, r.RemoteAddr, reason)
+	isiQueryRejected.WithLabelValues(reason).Inc()
+	http.Error(w, fmt.Sprintf("target %q is not allowed", target), http.StatusForbidden)
+	return "", false
+}
 
+// targetRegistry returns a registry with the collectors of a queried cluster,
+// or with the exporter up metric set to 0 if the cluster can not be reached,
+// and the client to close once the registry is gathered, if any.
+func targetRegistry(target string) (*prometheus.Registry, *isiclient.ISIClient) {
 	log.Debugf("Scraping target '%s'", target)
 
 	registry := prometheus.NewRegistry()
 
+	// Clusters polled in the background are served from their latest results
+	s := currentService()
+	if polled := s.polledCollector(target); polled != nil {
+		registry.MustRegister(polled)
+		return registry, nil
+	}
+
 	log.Info("Connecting to Isilon Cluster: " + target)
-	c, err := isiclient.NewIsiClient(config.ISI.UserName, config.ISI.Password, target)
+	c, err := isiclient.NewIsiClient(currentCredentials{}, target)
 	if err != nil {
 		log.Infof("Can't create Isilon Client connection : %s", err)
-		isiExporterUp.WithLabelValues(target).Set(0)
-		registry.MustRegister(isiExporterUp)
+		registry.MustRegister(collector.NewDownCollector(target))
 	} else {
 		log.Debug("Isilon Cluster version is: " + c.ISIVersion)
 		log.Debugf("Isilon Cluster node count: %v", c.NumNodes)
 
-		// cluster summary info
-		clusterSummaryExporter, err := collector.NewIsiClusterCollector(c, namespace)
-		if err != nil {
+		if err := registerCollectors(s.config, registry, c); err != nil {
 			log.Infof("Can't create exporter : %s", err)
-			isiExporterUp.WithLabelValues(target).Set(0)
-			registry.MustRegister(isiExporterUp)
-		} else {
-			log.Debugln("Register Cluster Summary exporter")
-			registry.MustRegister(clusterSummaryExporter)
+			// drop the collectors registered so far, which may report up as well
+			registry = prometheus.NewRegistry()
+			registry.MustRegister(collector.NewDownCollector(target))
 		}
 	}
-	// Delegate http serving to Prometheus client library, which will call collector.Collect.
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	return registry, c
+}
+
+// serveInflux writes the cluster metrics of g in the InfluxDB line protocol,
+// leaving out the metrics of the exporter process itself.
+func serveInflux(w http.ResponseWriter, g prometheus.Gatherer) {
+	families, err := g.Gather()
+	if err != nil {
+		http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cluster := families[:0]
+	for _, mf := range families {
+		if strings.HasPrefix(mf.GetName(), namespace+"_") {
+			cluster = append(cluster, mf)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := influx.Write(w, cluster, time.Now()); err != nil {
+		log.Infof("Unable to write line protocol: %s", err)
+	}
+}
+
+// runCollect connects to a cluster, runs its collectors once and prints the
+// results. It fails if any of the collectors did not succeed.
+func runCollect(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	target := fs.String("target", "", "Address of the cluster, defaults to the host of -url")
+	format := fs.String("format", "text", "Output format: text, openmetrics, json, table or influx")
+	fs.Parse(args)
+
+	write, ok := collectFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, must be text, openmetrics, json, table or influx", *format)
+	}
+	address, err := commandTarget(*target)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Connecting to Isilon Cluster: " + address)
+	c, err := isiclient.NewIsiClient(currentConfig().ISI.Credentials, address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to Isilon: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := registerCollectors(currentConfig(), registry, c); err != nil {
+		return fmt.Errorf("can't create exporter: %s", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	if err := write(os.Stdout, families); err != nil {
+		return err
+	}
+
+	if failed := failedCollectors(families); len(failed) > 0 {
+		return fmt.Errorf("collectors failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// failedCollectors returns the collectors whose scrape success, or exporter up
+// for the cluster collector, is 0.
+func failedCollectors(families []*dto.MetricFamily) (failed []string) {
+	for _, mf := range families {
+		name := mf.GetName()
+		switch {
+		case name == "emcisi_exporter_up":
+			name = "cluster"
+		case strings.HasPrefix(name, "emcisi_") && strings.HasSuffix(name, "_scrape_success"):
+			name = strings.TrimSuffix(strings.TrimPrefix(name, "emcisi_"), "_scrape_success")
+		default:
+			continue
+		}
+		for _, m := range mf.Metric {
+			if m.GetGauge().GetValue() == 0 {
+				failed = append(failed, name)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// collectFormats are the output formats of the collect command
+var collectFormats = map[string]func(io.Writer, []*dto.MetricFamily) error{
+	"text":        writeText,
+	"openmetrics": writeOpenMetrics,
+	"json":        writeJSON,
+	"table":       writeTable,
+	"influx":      writeInflux,
+}
+
+// writeInflux writes metric families in the InfluxDB line protocol
+func writeInflux(w io.Writer, families []*dto.MetricFamily) error {
+	return influx.Write(w, families, time.Now())
+}
+
+// writeText writes metric families in the Prometheus text format
+func writeText(w io.Writer, families []*dto.MetricFamily) error {
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonFamily is a metric family as written by the json format
+type jsonFamily struct {
+	Name    string       `json:"name"`
+	Help    string       `json:"help"`
+	Type    string       `json:"type"`
+	Metrics []jsonMetric `json:"metrics"`
+}
+
+// jsonMetric is a single sample as written by the json format. Summaries and
+// histograms are reduced to their count and sum.
+type jsonMetric struct {
+	Labels map[string]string `json:"labels"`
+	Value  *jsonFloat        `json:"value,omitempty"`
+	Count  *uint64           `json:"count,omitempty"`
+	Sum    *jsonFloat        `json:"sum,omitempty"`
+}
+
+// jsonFloat is a sample value, written as a string when JSON can not represent it
+type jsonFloat float64
+
+// MarshalJSON implements json.Marshaler.
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return json.Marshal(formatFloat(float64(f)))
+	}
+	return json.Marshal(float64(f))
+}
+
+// writeJSON writes metric families as a JSON array
+func writeJSON(w io.Writer, families []*dto.MetricFamily) error {
+	out := make([]jsonFamily, 0, len(families))
+	for _, mf := range families {
+		jf := jsonFamily{Name: mf.GetName(), Help: mf.GetHelp(), Type: strings.ToLower(mf.GetType().String())}
+		for _, m := range mf.Metric {
+			jm := jsonMetric{Labels: map[string]string{}}
+			for _, l := range m.Label {
+				jm.Labels[l.GetName()] = l.GetValue()
+			}
+			switch mf.GetType() {
+			case dto.MetricType_SUMMARY:
+				sum := jsonFloat(m.GetSummary().GetSampleSum())
+				jm.Count, jm.Sum = m.GetSummary().SampleCount, &sum
+			case dto.MetricType_HISTOGRAM:
+				sum := jsonFloat(m.GetHistogram().GetSampleSum())
+				jm.Count, jm.Sum = m.GetHistogram().SampleCount, &sum
+			default:
+				v := jsonFloat(sampleValue(m))
+				jm.Value = &v
+			}
+			jf.Metrics = append(jf.Metrics, jm)
+		}
+		out = append(out, jf)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeTable writes metric families as a table with one sample per row
+func writeTable(w io.Writer, families []*dto.MetricFamily) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tLABELS\tVALUE")
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			labels := make([]string, 0, len(m.Label))
+			for _, l := range m.Label {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			value := formatFloat(sampleValue(m))
+			switch mf.GetType() {
+			case dto.MetricType_SUMMARY:
+				value = fmt.Sprintf("count=%d sum=%s", m.GetSummary().GetSampleCount(), formatFloat(m.GetSummary().GetSampleSum()))
+			case dto.MetricType_HISTOGRAM:
+				value = fmt.Sprintf("count=%d sum=%s", m.GetHistogram().GetSampleCount(), formatFloat(m.GetHistogram().GetSampleSum()))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", mf.GetName(), strings.Join(labels, " "), value)
+		}
+	}
+	return tw.Flush()
+}
+
+// sampleValue returns the value of a gauge, counter or untyped sample
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	}
+	return m.GetUntyped().GetValue()
+}
+
+// runCommand runs a command given after the flags, e.g. backfill, instead of the exporter
+func runCommand(name string, args []string) error {
+	switch name {
+	case "backfill":
+		return runBackfill(args)
+	case "collect":
+		return runCollect(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
 }
 
 func main() {
+	setup()
+	if flag.NArg() > 0 {
+		// check is a Nagios plugin, its exit code is the state of the cluster
+		if flag.Arg(0) == "check" {
+			os.Exit(runCheck(flag.Args()[1:]))
+		}
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatalf("%s: %s", flag.Arg(0), err)
+		}
+		return
+	}
+
 	log.Info("Starting the Isilon Exporter service...")
 	log.Infof("commit: %s, build time: %s, release: %s",
 		commit, date, version,
@@ -119,8 +593,12 @@ func main() {
 	// This can go one of two ways
 	// either just monitor one device or go into a query mode based on flag/env variable "multiquery"
 	// to allow for multiple systems querying
-	if config.Exporter.MultiQuery {
+	if currentConfig().Exporter.MultiQuery {
 		log.Info("Running in multiquery mode...")
+		allowed := currentConfig().AllowedTargets
+		if len(currentConfig().Targets()) == 0 && len(allowed.Hostnames) == 0 && len(allowed.CIDRs) == 0 && len(allowed.Regexes) == 0 {
+			log.Warn("No clusters or allowed_targets are configured, every query will be rejected")
+		}
 		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`<html>
             <head>
@@ -144,54 +622,118 @@ func main() {
             <label>Target:</label> <input type="text" name="target" placeholder="X.X.X.X" value="1.2.3.4"><br>
             <input type="submit" value="Submit">
             </form>
+            <p><a href="/sd">Service discovery</a></p>
+            <p><a href="/status">Status</a></p>
             </html>`))
 		})
 
-		http.HandleFunc("/query", queryHandler)     // Endpoint to do specific cluster scrapes.
-		http.Handle("/metrics", promhttp.Handler()) // endpoint for exporter stats
+		http.HandleFunc("/query", queryHandler)        // Endpoint to do specific cluster scrapes.
+		http.HandleFunc("/influx", influxQueryHandler) // the same in the InfluxDB line protocol
+		http.HandleFunc("/sd", sdHandler)              // the configured clusters for HTTP service discovery
+		http.Handle("/metrics", promhttp.Handler())    // endpoint for exporter stats
 	} else {
 		log.Info("Running in single query mode...")
-		// we are only going to be watching one endpoint, so just watch that
-		u, err := url.Parse(config.ISI.IsiURL)
-		if err != nil {
-			log.Fatalf("Issue with Isilon URL: %s\n", err)
-		}
-		if u.Hostname() == "" {
-			log.Fatal("Hostname not defined.")
-		}
-
-		log.Info("Connecting to Isilon Cluster: " + u.Hostname())
-		c, err := isiclient.NewIsiClient(config.ISI.UserName, config.ISI.Password, u.Hostname())
-		if err != nil {
-			log.Fatal("Unable to connect to Isilon: ", err)
-		}
-
-		log.Debug("Isilon Cluster version is: " + c.ISIVersion)
-		log.Debugf("Isilon Cluster node count: %v", c.NumNodes)
-
-		// cluster summary info
-		clusterSummaryExporter, err := collector.NewIsiClusterCollector(c, namespace)
-		if err != nil {
-			log.Infof("Can't create exporter : %s", err)
-		} else {
-			log.Debugln("Register Cluster Summary exporter")
-			prometheus.MustRegister(clusterSummaryExporter)
-		}
-
 		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`<html>
 			<head><title>Dell EMC Isilon Exporter</title></head>
 			<body>
 			<h1>Dell EMC Isilon Exporter</h1>
 			<p><a href="/metrics">Metrics</a></p>
+			<p><a href="/status">Status</a></p>
 			</body>
 			</html>`))
 		})
 
-		http.Handle("/metrics", promhttp.Handler())
+		// the exporter's own metrics along with those of the cluster
+		gatherer := prometheus.Gatherers{prometheus.DefaultGatherer, prometheus.GathererFunc(clusterMetrics)}
+		http.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+		http.HandleFunc("/influx", func(w http.ResponseWriter, r *http.Request) {
+			serveInflux(w, gatherer)
+		})
+	}
+
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.HandleFunc("/-/ready", readyHandler)
+	http.HandleFunc("/status", statusHandler)
+
+	svc, err := newService(currentConfig(), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc.start(nil)
+
+	reloader := isiconfig.NewReloader(apply)
+	prometheus.MustRegister(reloader)
+	reload := func() error {
+		if err := reloader.Reload(); err != nil {
+			log.Errorf("Unable to reload the configuration: %s", err)
+			return err
+		}
+		log.Info("Reloaded the configuration")
+		return nil
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload()
+		}
+	}()
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	})
+
+	var webConfig *web.Config
+	if currentConfig().Exporter.WebConfigFile != "" {
+		var err error
+		if webConfig, err = web.LoadConfig(currentConfig().Exporter.WebConfigFile); err != nil {
+			log.Fatalf("Unable to load the web configuration: %s", err)
+		}
+		log.Infof("TLS enabled: %v, basic authentication users: %d", webConfig.TLSConfig.Enabled(), len(webConfig.Users))
+	}
+
+	exporter := currentConfig().Exporter
+	server := &http.Server{
+		Addr:         net.JoinHostPort(exporter.BindAddress, strconv.Itoa(exporter.BindPort)),
+		Handler:      http.DefaultServeMux,
+		ReadTimeout:  exporter.ReadTimeout,
+		WriteTimeout: exporter.WriteTimeout,
+	}
+	stopped := make(chan struct{})
+	go func() {
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+		sig := <-term
+		log.Infof("Received %s, shutting down", sig)
+		shutdown(server, reloader, exporter.ShutdownTimeout)
+		close(stopped)
+	}()
+
+	log.Info("Listening on: ", server.Addr)
+	if err := webConfig.ListenAndServe(server); err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
+	<-stopped
+	log.Info("Stopped the Isilon Exporter service")
+}
 
-	listenPort := fmt.Sprintf(":%v", config.Exporter.BindPort)
-	log.Info("Listening on port: ", listenPort)
-	log.Fatal(http.ListenAndServe(listenPort, nil))
+// shutdown stops accepting requests and stops the running service, waiting up
+// to timeout for in-flight scrapes and collections to finish.
+func shutdown(server *http.Server, reloader *isiconfig.Reloader, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Infof("Gave up waiting for in-flight requests: %s", err)
+	}
+	reloader.Stop()
+	if svc := currentService(); svc != nil {
+		svc.stop(ctx)
+	}
 }
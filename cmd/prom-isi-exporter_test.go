@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+)
+
+func TestQueryTarget(t *testing.T) {
+	_, network, _ := net.ParseCIDR("192.168.10.0/24")
+	currentCfg.Store(&isiconfig.Config{
+		Clusters: []isiconfig.ClusterConfig{
+			{Name: "isi01", Address: "10.1.0.5"},
+			{Name: "isi02"},
+		},
+		AllowedTargets: isiconfig.AllowedTargetsConfig{
+			Hostnames: []string{"isilon9.corp.com"},
+			CIDRs:     []isiconfig.CIDR{{IPNet: network}},
+		},
+	})
+
+	for _, tc := range []struct {
+		target  string
+		address string
+		code    int
+	}{
+		{target: "", code: http.StatusBadRequest},
+
+		// Configured clusters are connected to at their address
+		{target: "isi01", address: "10.1.0.5", code: http.StatusOK},
+		{target: "ISI01", address: "10.1.0.5", code: http.StatusOK},
+		{target: "10.1.0.5", address: "10.1.0.5", code: http.StatusOK},
+		{target: "isi02", address: "isi02", code: http.StatusOK},
+
+		{target: "isilon9.corp.com", address: "isilon9.corp.com", code: http.StatusOK},
+		{target: "Isilon9.Corp.Com", address: "Isilon9.Corp.Com", code: http.StatusOK},
+		{target: "isilon9.corp.com.evil.org", code: http.StatusForbidden},
+		{target: "192.168.10.7", address: "192.168.10.7", code: http.StatusOK},
+		{target: "192.168.11.7", code: http.StatusForbidden},
+		{target: "localhost", code: http.StatusForbidden},
+
+		// Targets that would change the URL the credentials are sent to
+		{target: "isi01:8080", code: http.StatusForbidden},
+		{target: "192.168.10.7:8080", code: http.StatusForbidden},
+		{target: "::ffff:192.168.10.7", code: http.StatusForbidden},
+		{target: "[::1]", code: http.StatusForbidden},
+		{target: "user@isi01", code: http.StatusForbidden},
+		{target: "isi01/platform", code: http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/metrics?target="+url.QueryEscape(tc.target), nil)
+		address, ok := queryTarget(w, r)
+		if ok != (tc.code == http.StatusOK) || w.Code != tc.code {
+			t.Errorf("target %q: got ok %t and status %d, want status %d", tc.target, ok, w.Code, tc.code)
+			continue
+		}
+		if address != tc.address {
+			t.Errorf("target %q: got address %q, want %q", tc.target, address, tc.address)
+		}
+	}
+}
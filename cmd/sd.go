@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+)
+
+// targetGroup is a target in the Prometheus HTTP service discovery format
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// targetGroups lists every configured cluster as a target of the query endpoint
+func targetGroups(cfg *isiconfig.Config) []targetGroup {
+	groups := []targetGroup{}
+	for _, target := range cfg.Targets() {
+		cl := cfg.Cluster(target)
+		labels := map[string]string{}
+		for name, value := range cfg.ServiceDiscovery.Labels {
+			labels[name] = value
+		}
+		for name, value := range cl.Labels {
+			labels[name] = value
+		}
+		if cl.Site != "" {
+			labels["site"] = cl.Site
+		}
+		if cl.Environment != "" {
+			labels["environment"] = cl.Environment
+		}
+		labels["__param_target"] = target
+		module := cfg.ServiceDiscovery.Module
+		if cl.Module != "" {
+			module = cl.Module
+		}
+		if module != "" {
+			labels["__param_module"] = module
+		}
+		groups = append(groups, targetGroup{Targets: []string{target}, Labels: labels})
+	}
+	return groups
+}
+
+// sdHandler serves the configured clusters for Prometheus HTTP service discovery
+func sdHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(targetGroups(currentConfig())); err != nil {
+		log.Infof("Unable to write the targets: %s", err)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/alertbridge"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/otlp"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/poller"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/push"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// connectRetryInterval is the time between two attempts to connect to the
+// cluster in single mode
+const connectRetryInterval = time.Minute
+
+// connectWorker is the name of the worker connecting to the cluster in single
+// mode, which closes the client when stopped
+const connectWorker = "cluster connection"
+
+var (
+	// currentCfg holds the *isiconfig.Config in use, replaced on every reload
+	currentCfg atomic.Value
+	// currentSvc holds the *service running for the configuration in use
+	currentSvc atomic.Value
+)
+
+// currentConfig returns the configuration in use
+func currentConfig() *isiconfig.Config {
+	return currentCfg.Load().(*isiconfig.Config)
+}
+
+// currentService returns the running service, nil when running a command
+func currentService() *service {
+	s, _ := currentSvc.Load().(*service)
+	return s
+}
+
+// currentCredentials are the credentials of the configuration in use, so
+// clients that outlive a reload log in with the reloaded credentials
+type currentCredentials struct{}
+
+// Get implements isiclient.Credentials.
+func (currentCredentials) Get() (string, string, error) {
+	return currentConfig().ISI.Credentials.Get()
+}
+
+// service is what the exporter runs for a configuration: the collectors of the
+// cluster in single mode, the background poller and the workers pushing and
+// forwarding metrics and events. A reload builds a new service, keeping the
+// parts whose settings did not change.
+type service struct {
+	config  *isiconfig.Config
+	targets []string
+	// clusters identifies the cluster settings the collectors were built from
+	clusters string
+	// poller polls the clusters with polling enabled, nil if there are none
+	poller *poller.Poller
+	// registry holds the collectors of the cluster in single mode
+	registry *prometheus.Registry
+	workers  []*worker
+}
+
+// worker is a part of the service running in the background
+type worker struct {
+	name string
+	// key identifies the settings the worker was built from
+	key    string
+	run    func(context.Context)
+	cancel context.CancelFunc
+	// done is closed when run returns
+	done chan struct{}
+}
+
+// settingsKey identifies a set of settings, so unchanged settings can be told
+// apart from changed ones on a reload
+func settingsKey(settings ...interface{}) string {
+	out, err := yaml.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// newService builds the service of a configuration, reusing the parts of the
+// old service, if any, whose settings did not change. Nothing is started.
+func newService(cfg *isiconfig.Config, old *service) (*service, error) {
+	s := &service{config: cfg}
+	var single string
+	if cfg.Exporter.MultiQuery {
+		s.targets = cfg.Targets()
+	} else {
+		u, err := url.Parse(cfg.ISI.IsiURL)
+		if err != nil {
+			return nil, errors.New("issue with Isilon URL: " + err.Error())
+		}
+		if u.Hostname() == "" {
+			return nil, errors.New("hostname not defined")
+		}
+		single = u.Hostname()
+		s.targets = []string{single}
+	}
+	s.clusters = settingsKey(s.targets, cfg.Exporter, cfg.Quota, cfg.Event, cfg.Statistics, cfg.Polling, cfg.Collectors, cfg.Clusters)
+
+	if old != nil && old.clusters == s.clusters {
+		s.poller, s.registry = old.poller, old.registry
+		if w := old.worker(connectWorker); w != nil {
+			s.workers = append(s.workers, w)
+		}
+	} else {
+		var polled []string
+		for _, t := range s.targets {
+			if cfg.Cluster(t).Polling.Enabled {
+				polled = append(polled, t)
+			}
+		}
+		if len(polled) > 0 {
+			log.Infof("Polling %d clusters in the background", len(polled))
+			s.poller = poller.New(polled, currentCredentials{}, polledCollectors(cfg))
+		}
+		if single != "" {
+			s.registry = prometheus.NewRegistry()
+			if s.poller != nil {
+				s.registry.MustRegister(s.poller.Collector(single))
+			} else if c, err := s.connect(cfg, single, nil); err == nil {
+				s.workers = append(s.workers, &worker{name: connectWorker, key: s.clusters, run: func(ctx context.Context) {
+					<-ctx.Done()
+					c.Close()
+				}})
+			} else {
+				// Serve the cluster as down rather than failing, and keep trying
+				log.Infof("Unable to connect to Isilon cluster %s, retrying every %s: %s", single, connectRetryInterval, err)
+				down := collector.NewDownCollector(single)
+				s.registry.MustRegister(down)
+				s.workers = append(s.workers, &worker{name: connectWorker, key: s.clusters, run: func(ctx context.Context) {
+					s.retryConnect(ctx, cfg, single, down)
+				}})
+			}
+		}
+	}
+
+	if s.poller != nil {
+		p := s.poller
+		s.addWorker(old, "background polling", s.clusters, func() (func(context.Context), error) {
+			return p.Run, nil
+		})
+	}
+	if cfg.Push.Enabled() {
+		err := s.addWorker(old, "push", settingsKey(s.clusters, cfg.Push), func() (func(context.Context), error) {
+			if len(s.targets) == 0 {
+				log.Warn("Push is enabled but no clusters are listed in the configuration file")
+			}
+			log.Infof("Pushing the metrics of %d clusters every %s", len(s.targets), cfg.Push.Interval)
+			return push.New(cfg.Push, s.targets, s.pushGatherer).Run, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.OTLP != nil {
+		err := s.addWorker(old, "OTLP export", settingsKey(s.clusters, cfg.OTLP), func() (func(context.Context), error) {
+			log.Infof("Exporting the metrics of %d clusters to %s over OTLP %s every %s", len(s.targets), cfg.OTLP.Endpoint, cfg.OTLP.Protocol, cfg.OTLP.Interval)
+			return otlp.New(*cfg.OTLP, s.targets, currentCredentials{}, s.clusterGatherer).Run, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Alerts.AlertmanagerURL != "" {
+		err := s.addWorker(old, "Alertmanager bridge", settingsKey(s.targets, cfg.Alerts), func() (func(context.Context), error) {
+			bridge, err := alertbridge.New(cfg.Alerts.AlertmanagerURL, cfg.Alerts.Interval, cfg.Alerts.StateFile,
+				s.targets, currentCredentials{})
+			if err != nil {
+				return nil, errors.New("unable to start the Alertmanager bridge: " + err.Error())
+			}
+			log.Infof("Forwarding events of %d clusters to %s every %s", len(s.targets), cfg.Alerts.AlertmanagerURL, cfg.Alerts.Interval)
+			return bridge.Run, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// connect connects to the cluster in single mode and registers its collectors,
+// replacing the down metric if given
+func (s *service) connect(cfg *isiconfig.Config, address string, down prometheus.Collector) (*isiclient.ISIClient, error) {
+	log.Info("Connecting to Isilon Cluster: " + address)
+	// cfg is not in use yet when a reload connects, so connect with its own
+	// credentials and follow the configuration in use from then on
+	c, err := isiclient.NewIsiClient(cfg.ISI.Credentials, address)
+	if err != nil {
+		return nil, err
+	}
+	c.Credentials = currentCredentials{}
+	if down != nil {
+		s.registry.Unregister(down)
+	}
+	log.Debug("Isilon Cluster version is: " + c.ISIVersion)
+	log.Debugf("Isilon Cluster node count: %v", c.NumNodes)
+	if err := registerCollectors(cfg, s.registry, c); err != nil {
+		log.Infof("Can't create exporter : %s", err)
+	}
+	return c, nil
+}
+
+// retryConnect tries to connect to the cluster in single mode until it
+// succeeds, and closes the client once ctx is cancelled
+func (s *service) retryConnect(ctx context.Context, cfg *isiconfig.Config, address string, down prometheus.Collector) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(connectRetryInterval):
+		}
+		c, err := s.connect(cfg, address, down)
+		if err == nil {
+			<-ctx.Done()
+			c.Close()
+			return
+		}
+		log.Infof("Unable to connect to Isilon cluster %s, retrying in %s: %s", address, connectRetryInterval, err)
+	}
+}
+
+// addWorker adds the worker of the old service when it was built from the same
+// settings, or else builds a new one
+func (s *service) addWorker(old *service, name, key string, build func() (func(context.Context), error)) error {
+	if w := old.worker(name); w != nil && w.key == key {
+		s.workers = append(s.workers, w)
+		return nil
+	}
+	run, err := build()
+	if err != nil {
+		return err
+	}
+	s.workers = append(s.workers, &worker{name: name, key: key, run: run})
+	return nil
+}
+
+// worker returns the worker of the service with the given name, if any
+func (s *service) worker(name string) *worker {
+	if s == nil {
+		return nil
+	}
+	for _, w := range s.workers {
+		if w.name == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// start makes the service the running one, starting its new workers and
+// stopping those of the old service it replaces.
+func (s *service) start(old *service) {
+	currentCfg.Store(s.config)
+	currentSvc.Store(s)
+	for _, w := range s.workers {
+		if w.cancel != nil {
+			continue
+		}
+		var ctx context.Context
+		ctx, w.cancel = context.WithCancel(context.Background())
+		w.done = make(chan struct{})
+		log.Debugf("Starting the %s", w.name)
+		go func(w *worker) {
+			defer close(w.done)
+			w.run(ctx)
+		}(w)
+	}
+	if old == nil {
+		return
+	}
+	for _, w := range old.workers {
+		if s.worker(w.name) != w {
+			log.Infof("Stopping the %s", w.name)
+			w.cancel()
+		}
+	}
+}
+
+// stop stops the workers of the service and waits for them to finish what they
+// are doing, or for ctx to be done.
+func (s *service) stop(ctx context.Context) {
+	for _, w := range s.workers {
+		if w.cancel != nil {
+			w.cancel()
+		}
+	}
+	for _, w := range s.workers {
+		if w.done == nil {
+			continue
+		}
+		select {
+		case <-w.done:
+			log.Debugf("Stopped the %s", w.name)
+		case <-ctx.Done():
+			log.Infof("Gave up waiting for the %s to stop", w.name)
+			return
+		}
+	}
+}
+
+// apply builds and starts the service of a reloaded configuration
+func apply(cfg *isiconfig.Config) error {
+	old := currentService()
+	s, err := newService(cfg, old)
+	if err != nil {
+		return err
+	}
+	s.start(old)
+	return nil
+}
+
+// clusterMetrics gathers the metrics of the cluster in single mode
+func clusterMetrics() ([]*dto.MetricFamily, error) {
+	s := currentService()
+	if s == nil || s.registry == nil {
+		return nil, nil
+	}
+	return s.registry.Gather()
+}
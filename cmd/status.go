@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+)
+
+// clusterStatus is a cluster on the status page
+type clusterStatus struct {
+	Address       string     `json:"address"`
+	Name          string     `json:"name,omitempty"`
+	Version       string     `json:"version,omitempty"`
+	Up            bool       `json:"up"`
+	LastScrape    *time.Time `json:"last_scrape,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	Latency       float64    `json:"latency_seconds"`
+}
+
+// clusterStatuses returns the status of the configured clusters and of every
+// other cluster the exporter talked to
+func clusterStatuses() []clusterStatus {
+	var out []clusterStatus
+	seen := map[string]bool{}
+	for _, s := range isiclient.Statuses() {
+		cs := clusterStatus{
+			Address: s.Address,
+			Name:    s.Name,
+			Version: s.Version,
+			Up:      s.Up(),
+			Latency: s.Latency.Seconds(),
+		}
+		if !s.LastSuccess.IsZero() {
+			t := s.LastSuccess
+			cs.LastScrape = &t
+		}
+		if !s.LastErrorTime.IsZero() {
+			t := s.LastErrorTime
+			cs.LastError, cs.LastErrorTime = s.LastError, &t
+		}
+		out = append(out, cs)
+		seen[strings.ToLower(s.Address)] = true
+	}
+	if svc := currentService(); svc != nil {
+		for _, t := range svc.targets {
+			if !seen[strings.ToLower(t)] {
+				out = append(out, clusterStatus{Address: t})
+			}
+		}
+	}
+	return out
+}
+
+// healthyHandler answers as long as the exporter runs
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Healthy.\n"))
+}
+
+// readyHandler answers once the exporter serves a valid configuration. It
+// does not depend on the clusters being reachable.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if currentService() == nil {
+		http.Error(w, "Not ready.", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("Ready.\n"))
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<html>
+<head><title>Isilon Exporter Status</title>
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.up { color: green; }
+.down { color: red; }
+</style>
+</head>
+<body>
+<h1>Isilon Exporter Status</h1>
+<table>
+<tr><th>Address</th><th>Cluster</th><th>OneFS</th><th>State</th><th>Last scrape</th><th>API latency</th><th>Last error</th></tr>
+{{range .}}<tr>
+<td>{{.Address}}</td>
+<td>{{.Name}}</td>
+<td>{{.Version}}</td>
+<td>{{if .Up}}<span class="up">UP</span>{{else if .LastError}}<span class="down">DOWN</span>{{else}}UNKNOWN{{end}}</td>
+<td>{{with .LastScrape}}{{.Format "2006-01-02 15:04:05 MST"}}{{end}}</td>
+<td>{{if .Latency}}{{printf "%.3fs" .Latency}}{{end}}</td>
+<td>{{with .LastErrorTime}}{{.Format "2006-01-02 15:04:05 MST"}}: {{end}}{{.LastError}}</td>
+</tr>
+{{end}}</table>
+<p><a href="/status?format=json">JSON</a></p>
+</body>
+</html>
+`))
+
+// statusHandler lists the known clusters as HTML, or as JSON when asked for
+// with format=json or an Accept header
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := clusterStatuses()
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if statuses == nil {
+			statuses = []clusterStatus{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]interface{}{"clusters": statuses}); err != nil {
+			log.Infof("Unable to write the status: %s", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, statuses); err != nil {
+		log.Infof("Unable to write the status: %s", err)
+	}
+}
@@ -5,6 +5,7 @@ require (
 	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf
 	github.com/beorn7/perks v0.0.0-20160804104726-4c0e84591b9a
 	github.com/golang/protobuf v1.0.0
+	github.com/golang/snappy v0.0.1
 	github.com/jamiealquiza/envy v1.0.0
 	github.com/matttproud/golang_protobuf_extensions v1.0.0
 	github.com/prometheus/client_golang v0.8.0
@@ -17,4 +18,5 @@ require (
 	golang.org/x/crypto v0.0.0-20180308185624-c7dcf104e3a7
 	golang.org/x/sys v0.0.0-20180308152046-7dca6fe1f437
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,258 @@
+// Package alertbridge forwards the unresolved OneFS event groups of Isilon
+// clusters to an Alertmanager as alerts.
+package alertbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/common/log"
+)
+
+// alertName is the alertname label of every alert sent by the bridge
+const alertName = "IsilonEvent"
+
+// Alert is an alert as accepted by the Alertmanager v2 API
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// Bridge polls the event groups of a set of clusters and forwards them to Alertmanager
+type Bridge struct {
+	// AlertmanagerURL is the base URL of the Alertmanager, e.g. http://localhost:9093
+	AlertmanagerURL string
+	// Interval is the time between two polls of the clusters
+	Interval time.Duration
+	// StateFile keeps the alerts sent so far so resolutions are not lost across restarts
+	StateFile string
+	// Targets are the addresses of the clusters to poll
+	Targets []string
+	// Credentials are used to connect to the clusters
+	Credentials isiclient.Credentials
+	// HTTPClient is used to talk to the Alertmanager
+	HTTPClient *http.Client
+
+	mtx     sync.Mutex
+	clients map[string]*isiclient.ISIClient
+	// firing holds the alerts last sent per cluster, keyed by event group id
+	firing map[string]map[string]Alert
+}
+
+// New returns a Bridge with its state loaded from stateFile.
+func New(alertmanagerURL string, interval time.Duration, stateFile string, targets []string, creds isiclient.Credentials) (*Bridge, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("alert interval must be positive, not %s", interval)
+	}
+	b := &Bridge{
+		AlertmanagerURL: strings.TrimSuffix(alertmanagerURL, "/"),
+		Interval:        interval,
+		StateFile:       stateFile,
+		Targets:         targets,
+		Credentials:     creds,
+		HTTPClient:      &http.Client{Timeout: 30 * time.Second},
+		clients:         map[string]*isiclient.ISIClient{},
+		firing:          map[string]map[string]Alert{},
+	}
+	if err := b.loadState(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Run polls the clusters every Interval until ctx is cancelled.
+func (b *Bridge) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	defer b.close()
+	for {
+		for _, target := range b.Targets {
+			if err := b.Poll(target); err != nil {
+				log.Infof("Unable to forward events of %s to Alertmanager: %s", target, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads the unresolved event groups of one cluster and sends them, along
+// with any event groups resolved since the last poll, to the Alertmanager.
+func (b *Bridge) Poll(target string) error {
+	c, err := b.client(target)
+	if err != nil {
+		return err
+	}
+	groups, err := collector.ActiveEventGroups(c)
+	if err != nil {
+		return err
+	}
+	return b.forward(c.ClusterName, groups)
+}
+
+// forward sends the unresolved event groups of a cluster, along with any event
+// groups resolved since the last poll, to the Alertmanager.
+func (b *Bridge) forward(cluster string, groups []collector.EventGroup) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	// Alerts are resent on every poll and expire on their own should the bridge stop
+	now := time.Now()
+	expires := now.Add(3 * b.Interval)
+	previous := b.firing[cluster]
+	current := make(map[string]Alert, len(groups))
+	var alerts []Alert
+	for _, g := range groups {
+		a := newAlert(cluster, g)
+		if old, ok := previous[g.ID]; ok {
+			a.StartsAt = old.StartsAt
+		}
+		a.EndsAt = expires
+		current[g.ID] = a
+		alerts = append(alerts, a)
+	}
+	for id, a := range previous {
+		if _, ok := current[id]; !ok {
+			a.EndsAt = now
+			alerts = append(alerts, a)
+		}
+	}
+
+	if len(alerts) > 0 {
+		if err := b.send(alerts); err != nil {
+			return err
+		}
+	}
+	log.Debugf("Sent %d alerts for %s to Alertmanager", len(alerts), cluster)
+	b.firing[cluster] = current
+	return b.saveState()
+}
+
+// newAlert maps an event group to an alert
+func newAlert(cluster string, g collector.EventGroup) Alert {
+	a := Alert{
+		Labels: map[string]string{
+			"alertname":   alertName,
+			"clustername": cluster,
+			"severity":    g.Severity,
+			"event_id":    g.ID,
+		},
+		Annotations: map[string]string{
+			"summary": g.Message,
+		},
+		StartsAt: time.Unix(g.Noticed, 0),
+	}
+	if g.Noticed == 0 {
+		a.StartsAt = time.Now()
+	}
+	if g.Category != "" {
+		a.Labels["category"] = g.Category
+	}
+	if g.Node != "" {
+		a.Labels["node"] = g.Node
+	}
+	return a
+}
+
+// send posts alerts to the Alertmanager v2 API
+func (b *Bridge) send(alerts []Alert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	resp, err := b.HTTPClient.Post(b.AlertmanagerURL+"/api/v2/alerts", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("alertmanager returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// client returns the cached client of a cluster, connecting to it if needed
+func (b *Bridge) client(target string) (*isiclient.ISIClient, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if c, ok := b.clients[target]; ok {
+		return c, nil
+	}
+	c, err := isiclient.NewIsiClient(b.Credentials, target)
+	if err != nil {
+		return nil, err
+	}
+	b.clients[target] = c
+	return c, nil
+}
+
+// close closes the clients of the connected clusters
+func (b *Bridge) close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for target, c := range b.clients {
+		c.Close()
+		delete(b.clients, target)
+	}
+}
+
+// loadState reads the alerts sent before the last restart
+func (b *Bridge) loadState() error {
+	if b.StateFile == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(b.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &b.firing); err != nil {
+		return fmt.Errorf("reading alert state %s: %s", b.StateFile, err)
+	}
+	return nil
+}
+
+// saveState writes the alerts currently firing, replacing the state file atomically
+func (b *Bridge) saveState() error {
+	if b.StateFile == "" {
+		return nil
+	}
+	content, err := json.Marshal(b.firing)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(b.StateFile), filepath.Base(b.StateFile))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), b.StateFile)
+}
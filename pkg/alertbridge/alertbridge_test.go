@@ -0,0 +1,134 @@
+package alertbridge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+)
+
+// fakeAlertmanager records the alerts posted to it
+type fakeAlertmanager struct {
+	mtx   sync.Mutex
+	posts [][]Alert
+}
+
+func (f *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/alerts" {
+		http.Error(w, "unexpected request", http.StatusNotFound)
+		return
+	}
+	var alerts []Alert
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mtx.Lock()
+	f.posts = append(f.posts, alerts)
+	f.mtx.Unlock()
+}
+
+// last returns the alerts of the last post, failing if there were not n posts
+func (f *fakeAlertmanager) last(t *testing.T, n int) map[string]Alert {
+	t.Helper()
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if len(f.posts) != n {
+		t.Fatalf("got %d posts, want %d", len(f.posts), n)
+	}
+	alerts := map[string]Alert{}
+	for _, a := range f.posts[n-1] {
+		alerts[a.Labels["event_id"]] = a
+	}
+	return alerts
+}
+
+func TestNewRejectsInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		if _, err := New("http://localhost:9093", interval, "", nil, nil); err == nil {
+			t.Errorf("New accepted interval %s", interval)
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	am := &fakeAlertmanager{}
+	srv := httptest.NewServer(am)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "alertbridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state := filepath.Join(dir, "alerts.json")
+
+	b, err := New(srv.URL+"/", time.Minute, state, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := collector.EventGroup{ID: "1", Severity: "critical", Category: "100000000", Node: "2", Message: "drive failed", Noticed: 1500000000}
+	quota := collector.EventGroup{ID: "2", Severity: "warning", Message: "quota exceeded", Noticed: 1500000100}
+
+	// New event groups fire until after the next polls
+	if err := b.forward("isi01", []collector.EventGroup{disk, quota}); err != nil {
+		t.Fatal(err)
+	}
+	alerts := am.last(t, 1)
+	a, ok := alerts["1"]
+	if !ok || len(alerts) != 2 {
+		t.Fatalf("got alerts %v, want event groups 1 and 2", alerts)
+	}
+	want := map[string]string{"alertname": alertName, "clustername": "isi01", "severity": "critical", "event_id": "1", "category": "100000000", "node": "2"}
+	for name, value := range want {
+		if a.Labels[name] != value {
+			t.Errorf("label %s is %q, want %q", name, a.Labels[name], value)
+		}
+	}
+	if a.Annotations["summary"] != "drive failed" {
+		t.Errorf("summary is %q", a.Annotations["summary"])
+	}
+	if !a.StartsAt.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("startsAt is %s", a.StartsAt)
+	}
+	if !a.EndsAt.After(time.Now().Add(2 * time.Minute)) {
+		t.Errorf("endsAt %s does not outlast the next polls", a.EndsAt)
+	}
+
+	// An event group that is gone is resolved
+	if err := b.forward("isi01", []collector.EventGroup{disk}); err != nil {
+		t.Fatal(err)
+	}
+	alerts = am.last(t, 2)
+	if len(alerts) != 2 || !alerts["1"].EndsAt.After(time.Now()) || alerts["2"].EndsAt.After(time.Now()) {
+		t.Fatalf("got alerts %v, want 1 firing and 2 resolved", alerts)
+	}
+
+	// After a restart the state file resolves what was firing before
+	b, err = New(srv.URL, time.Minute, state, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.forward("isi01", nil); err != nil {
+		t.Fatal(err)
+	}
+	alerts = am.last(t, 3)
+	if len(alerts) != 1 || alerts["1"].EndsAt.After(time.Now()) {
+		t.Fatalf("got alerts %v, want 1 resolved", alerts)
+	}
+	if !alerts["1"].StartsAt.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("startsAt of the resolved alert is %s", alerts["1"].StartsAt)
+	}
+
+	// Resolved alerts are not sent again
+	if err := b.forward("isi01", nil); err != nil {
+		t.Fatal(err)
+	}
+	am.last(t, 3)
+}
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"fmt"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -72,56 +72,6 @@ var (
 		"Traffic from disk (in bytes/sec).",
 		[]string{"clustername"}, nil,
 	)
-	clusterIFSBytesAvail = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_avail"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	clusterIFSBytesFree = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_free"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	clusterIFSBytesTotal = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_total"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	clusterSSDIFSBytesAvail = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_avail"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	clusterSSDIFSBytesFree = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_free"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	clusterSSDIFSBytesTotal = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_total"),
-		"Traffic from disk (in bytes/sec).",
-		[]string{"clustername"}, nil,
-	)
-	alertsnumcritical = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "alerts_critical"),
-		"Number of current critical alerts for the cluster",
-		[]string{"clustername"}, nil,
-	)
-	alertsnumerror = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "alerts_error"),
-		"Number of current error alerts for the cluster",
-		[]string{"clustername"}, nil,
-	)
-	alertsnuminfo = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "alerts_info"),
-		"Number of current info alerts for the cluster",
-		[]string{"clustername"}, nil,
-	)
-	alertsnumwarning = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "alerts_warning"),
-		"Number of current warning alerts for the cluster",
-		[]string{"clustername"}, nil,
-	)
 	nodeDiskBusy = prometheus.NewDesc(
 		prometheus.BuildFQName("emcisi", "node", "disk_busy"),
 		"The percentage of time the drive was busy.",
@@ -142,31 +92,56 @@ var (
 		"The rate of bytes read.",
 		[]string{"clustername", "drive_id", "type"}, nil,
 	)
-	pathHardQuota = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "hard_quota"),
-		"HardQuota of a path bytes",
-		[]string{"clustername", "path"}, nil,
-	)
-	pathAdvisoryQuota = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "advisory_quota"),
-		"Advisory Quota of a path bytes",
-		[]string{"clustername", "path"}, nil,
+	clusterNetInBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "net_in_bytes_total"),
+		"Bytes received on the external network interfaces of the cluster.",
+		[]string{"clustername"}, nil,
 	)
-	pathLogicalUsed = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "logical_used"),
-		"Used data w/o overhead of a path bytes",
-		[]string{"clustername", "path"}, nil,
+	clusterNetOutBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "net_out_bytes_total"),
+		"Bytes sent on the external network interfaces of the cluster.",
+		[]string{"clustername"}, nil,
 	)
-	pathPhysicalUsed = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "cluster", "physical_used"),
-		"Used Data w/overhead of a path bytes",
-		[]string{"clustername", "path"}, nil,
+	clusterDiskInBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "disk_in_bytes_total"),
+		"Bytes written to disk.",
+		[]string{"clustername"}, nil,
 	)
-	exporterUp = prometheus.NewDesc(
-		prometheus.BuildFQName("emcisi", "exporter", "up"),
-		"Indicates if scrape was succesful or not.",
+	clusterDiskOutBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "disk_out_bytes_total"),
+		"Bytes read from disk.",
 		[]string{"clustername"}, nil,
 	)
+	clusterProtocolBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "protocol_bytes_total"),
+		"Bytes transferred per protocol, accumulated by the exporter from the throughput reported by OneFS.",
+		[]string{"clustername", "protocol"}, nil,
+	)
+	clusterProtocolOperations = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "protocol_operations_total"),
+		"Operations per protocol.",
+		[]string{"clustername", "protocol"}, nil,
+	)
+	nodeNetInBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "node", "net_in_bytes_total"),
+		"Bytes received on the external network interfaces of the node.",
+		[]string{"clustername", "node"}, nil,
+	)
+	nodeNetOutBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "node", "net_out_bytes_total"),
+		"Bytes sent on the external network interfaces of the node.",
+		[]string{"clustername", "node"}, nil,
+	)
+	nodeDiskInBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "node", "disk_in_bytes_total"),
+		"Bytes written to the drive, accumulated by the exporter from the rate reported by OneFS.",
+		[]string{"clustername", "drive_id", "type"}, nil,
+	)
+	nodeDiskOutBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "node", "disk_out_bytes_total"),
+		"Bytes read from the drive, accumulated by the exporter from the rate reported by OneFS.",
+		[]string{"clustername", "drive_id", "type"}, nil,
+	)
 	isiClusterInfo = prometheus.NewDesc(
 		prometheus.BuildFQName("emcisi", "cluster", "version"),
 		"A metric with a constant '1' value labeled by version, and nodecount",
@@ -179,19 +154,56 @@ var (
 	)
 )
 
+// clusterSpaceStats are the statistics keys of the cluster space and their metrics
+var clusterSpaceStats = map[string]*statisticDesc{
+	"ifs.bytes.avail": newStatisticDesc("ifs.bytes.avail", prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_avail"),
+		"Bytes available for use on the OneFS file system.", "clustername"),
+	"ifs.bytes.free": newStatisticDesc("ifs.bytes.free", prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_free"),
+		"Bytes free on the OneFS file system, including space reserved for virtual hot spare.", "clustername"),
+	"ifs.bytes.total": newStatisticDesc("ifs.bytes.total", prometheus.BuildFQName("emcisi", "cluster", "ifs_bytes_total"),
+		"Total capacity in bytes of the OneFS file system.", "clustername"),
+	"ifs.ssd.bytes.avail": newStatisticDesc("ifs.ssd.bytes.avail", prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_avail"),
+		"Bytes available for use on the SSDs of the OneFS file system.", "clustername"),
+	"ifs.ssd.bytes.free": newStatisticDesc("ifs.ssd.bytes.free", prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_free"),
+		"Bytes free on the SSDs of the OneFS file system, including space reserved for virtual hot spare.", "clustername"),
+	"ifs.ssd.bytes.total": newStatisticDesc("ifs.ssd.bytes.total", prometheus.BuildFQName("emcisi", "cluster", "ifs_ssd_bytes_total"),
+		"Total capacity in bytes of the SSDs of the OneFS file system.", "clustername"),
+}
+
+// throughputProtocols are the protocols whose throughput is reported in the system summary
+var throughputProtocols = []string{"ftp", "hdfs", "http", "iscsi", "nfs", "smb"}
+
+// byteCounter is a cluster wide byte counter read from a cumulative statistics
+// key. Clusters without the key get it accumulated from the summary rate.
+type byteCounter struct {
+	desc    *prometheus.Desc
+	key     string
+	summary string
+}
+
+var clusterByteCounters = []byteCounter{
+	{clusterNetInBytes, "cluster.net.ext.bytes.in", "net_in"},
+	{clusterNetOutBytes, "cluster.net.ext.bytes.out", "net_out"},
+	{clusterDiskInBytes, "cluster.disk.bytes.in", "disk_in"},
+	{clusterDiskOutBytes, "cluster.disk.bytes.out", "disk_out"},
+}
+
 // A IsiClusterCollector implements the prometheus.Collector.
 type IsiClusterCollector struct {
 	isiClient *isiclient.ISIClient
 	namespace string
+	// rateGauges also exports the averaged throughput gauges the counters replace
+	rateGauges bool
 }
 
 // NewIsiClusterCollector returns an initialized Isilon Cluster Collector.
-func NewIsiClusterCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiClusterCollector, error) {
+func NewIsiClusterCollector(emcisi *isiclient.ISIClient, namespace string, rateGauges bool) (*IsiClusterCollector, error) {
 
 	log.Debugln("Init exporter")
 	return &IsiClusterCollector{
-		isiClient: emcisi,
-		namespace: namespace,
+		isiClient:  emcisi,
+		namespace:  namespace,
+		rateGauges: rateGauges,
 	}, nil
 }
 
@@ -206,7 +218,7 @@ func (e *IsiClusterCollector) Collect(ch chan<- prometheus.Metric) {
 		log.Errorf("Isilon client not configured.")
 		duration := float64(time.Since(start).Seconds())
 		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
 		return
 	}
 
@@ -219,22 +231,25 @@ func (e *IsiClusterCollector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		duration := float64(time.Since(start).Seconds())
 		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
 		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(clusterSummaryCPU, prometheus.GaugeValue, gjson.Get(s, "system.0.cpu").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryFTPthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.ftp").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryHTTPthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.http").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryHDFSthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.hdfs").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryiSCSIthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.iscsi").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummarySMBthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.smb").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryNFSthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.nfs").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryNetInthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.net_in").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryNetOutthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.net_out").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryDiskInthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.disk_in").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryDiskOutthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.disk_out").Float(), e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(clusterSummaryNetTotalthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.total").Float(), e.isiClient.ClusterName)
+	if e.rateGauges {
+		ch <- prometheus.MustNewConstMetric(clusterSummaryFTPthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.ftp").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryHTTPthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.http").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryHDFSthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.hdfs").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryiSCSIthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.iscsi").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummarySMBthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.smb").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryNFSthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.nfs").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryNetInthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.net_in").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryNetOutthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.net_out").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryDiskInthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.disk_in").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryDiskOutthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.disk_out").Float(), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(clusterSummaryNetTotalthroughput, prometheus.GaugeValue, gjson.Get(s, "system.0.total").Float(), e.isiClient.ClusterName)
+	}
+	e.collectCounters(ch, gjson.Get(s, "system.0"))
 
 	// Get cluster space information
 	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/statistics/current?key=ifs.bytes.total&key=ifs.ssd.bytes.total&key=ifs.bytes.free&key=ifs.ssd.bytes.free&key=ifs.bytes.avail&key=ifs.ssd.bytes.avail&devid=all"
@@ -242,26 +257,15 @@ func (e *IsiClusterCollector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		duration := float64(time.Since(start).Seconds())
 		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
 		return
 	}
 	result := gjson.Get(s, "stats")
 	result.ForEach(func(key, value gjson.Result) bool {
-		switch gjson.Get(value.String(), "key").String() {
-		case "ifs.bytes.avail":
-			ch <- prometheus.MustNewConstMetric(clusterIFSBytesAvail, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		case "ifs.bytes.free":
-			ch <- prometheus.MustNewConstMetric(clusterIFSBytesFree, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		case "ifs.bytes.total":
-			ch <- prometheus.MustNewConstMetric(clusterIFSBytesTotal, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		case "ifs.ssd.bytes.avail":
-			ch <- prometheus.MustNewConstMetric(clusterSSDIFSBytesAvail, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		case "ifs.ssd.bytes.free":
-			ch <- prometheus.MustNewConstMetric(clusterSSDIFSBytesFree, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		case "ifs.ssd.bytes.total":
-			ch <- prometheus.MustNewConstMetric(clusterSSDIFSBytesTotal, prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
-		default:
-			fmt.Println("Got something else")
+		if d, ok := clusterSpaceStats[gjson.Get(value.String(), "key").String()]; ok {
+			ch <- prometheus.MustNewConstMetric(d.desc(e.isiClient), prometheus.GaugeValue, gjson.Get(value.String(), "value").Float(), e.isiClient.ClusterName)
+		} else {
+			log.Debugf("Unexpected statistics key %s", gjson.Get(value.String(), "key").String())
 		}
 		return true
 	})
@@ -272,7 +276,7 @@ func (e *IsiClusterCollector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		duration := float64(time.Since(start).Seconds())
 		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
 		return
 	}
 	result = gjson.Get(s, "drive")
@@ -282,52 +286,101 @@ func (e *IsiClusterCollector) Collect(ch chan<- prometheus.Metric) {
 		dtype := gjson.Get(value.String(), "type").String()
 		ch <- prometheus.MustNewConstMetric(nodeDiskBusy, prometheus.GaugeValue, gjson.Get(value.String(), "busy").Float(), e.isiClient.ClusterName, did, dtype)
 		ch <- prometheus.MustNewConstMetric(nodeDiskAccessLatency, prometheus.GaugeValue, gjson.Get(value.String(), "access_latency").Float(), e.isiClient.ClusterName, did, dtype)
-		ch <- prometheus.MustNewConstMetric(nodeDiskBytesIn, prometheus.GaugeValue, gjson.Get(value.String(), "bytes_in").Float(), e.isiClient.ClusterName, did, dtype)
-		ch <- prometheus.MustNewConstMetric(nodeDiskBytesOut, prometheus.GaugeValue, gjson.Get(value.String(), "bytes_out").Float(), e.isiClient.ClusterName, did, dtype)
+		bytesIn := gjson.Get(value.String(), "bytes_in").Float()
+		bytesOut := gjson.Get(value.String(), "bytes_out").Float()
+		if e.rateGauges {
+			ch <- prometheus.MustNewConstMetric(nodeDiskBytesIn, prometheus.GaugeValue, bytesIn, e.isiClient.ClusterName, did, dtype)
+			ch <- prometheus.MustNewConstMetric(nodeDiskBytesOut, prometheus.GaugeValue, bytesOut, e.isiClient.ClusterName, did, dtype)
+		}
+		// OneFS only reports the drive rates, so the counters are kept by the exporter
+		ch <- prometheus.MustNewConstMetric(nodeDiskInBytes, prometheus.CounterValue, accumulateRate(e.isiClient.ClusterName, "drive."+did+".in", bytesIn), e.isiClient.ClusterName, did, dtype)
+		ch <- prometheus.MustNewConstMetric(nodeDiskOutBytes, prometheus.CounterValue, accumulateRate(e.isiClient.ClusterName, "drive."+did+".out", bytesOut), e.isiClient.ClusterName, did, dtype)
 		return true
 	})
 
-	// get count of errors in "information", "warning" and "error" states that are not resolved
-	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/event/eventgroup-occurrences?resolved=false&ignore=false"
-	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
-	if err != nil {
-		duration := float64(time.Since(start).Seconds())
-		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
-		return
+	duration := float64(time.Since(start).Seconds())
+	ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
+	ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 1, e.isiClient.ClusterName)
+	log.Debugf("Scrape of target '%s' took %f seconds", e.isiClient.ClusterName, duration)
+	log.Infoln("Cluster exporter finished")
+}
+
+// collectCounters delivers the throughput of the cluster as counters. Cumulative
+// statistics keys are used where OneFS provides them, everything else is
+// accumulated from the averaged rates of the system summary.
+func (e *IsiClusterCollector) collectCounters(ch chan<- prometheus.Metric, system gjson.Result) {
+	for _, p := range throughputProtocols {
+		ch <- prometheus.MustNewConstMetric(clusterProtocolBytes, prometheus.CounterValue, accumulateRate(e.isiClient.ClusterName, "protocol."+p, system.Get(p).Float()), e.isiClient.ClusterName, p)
 	}
-	result = gjson.Get(s, `eventgroups.#[severity=="warning"]#`)
-	ch <- prometheus.MustNewConstMetric(alertsnumwarning, prometheus.GaugeValue, arrayCount(result), e.isiClient.ClusterName)
-	result = gjson.Get(s, `eventgroups.#[severity=="information"]#`)
-	ch <- prometheus.MustNewConstMetric(alertsnuminfo, prometheus.GaugeValue, arrayCount(result), e.isiClient.ClusterName)
-	result = gjson.Get(s, `eventgroups.#[severity=="error"]#`)
-	ch <- prometheus.MustNewConstMetric(alertsnumerror, prometheus.GaugeValue, arrayCount(result), e.isiClient.ClusterName)
-	result = gjson.Get(s, `eventgroups.#[severity=="error"]#`)
-	ch <- prometheus.MustNewConstMetric(alertsnumcritical, prometheus.GaugeValue, arrayCount(result), e.isiClient.ClusterName)
 
-	//Quota Collection
-	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/quota/quotas"
-	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	keys := []string{}
+	for _, c := range clusterByteCounters {
+		keys = append(keys, c.key)
+	}
+	for _, p := range throughputProtocols {
+		keys = append(keys, "cluster.protostats."+p+".total")
+	}
+	stats := e.currentCounters(url.Values{"key": keys})
+	for _, c := range clusterByteCounters {
+		if v, ok := stats[c.key]; ok {
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, v.Get("value").Float(), e.isiClient.ClusterName)
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, accumulateRate(e.isiClient.ClusterName, c.summary, system.Get(c.summary).Float()), e.isiClient.ClusterName)
+		}
+	}
+	for _, p := range throughputProtocols {
+		if v, ok := stats["cluster.protostats."+p+".total"]; ok {
+			ch <- prometheus.MustNewConstMetric(clusterProtocolOperations, prometheus.CounterValue, v.Get("value").Float(), e.isiClient.ClusterName, p)
+		}
+	}
+
+	nodeStats := e.currentCounters(url.Values{"key": []string{"node.net.ext.bytes.in", "node.net.ext.bytes.out"}, "devid": []string{"all"}})
+	if len(nodeStats) == 0 {
+		return
+	}
+	// Label nodes by lnn like the other collectors, rather than by devid
+	lnns, err := nodeLNNs(e.isiClient)
 	if err != nil {
-		duration := float64(time.Since(start).Seconds())
-		ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		log.Infof("Unable to retrieve cluster devices from %s: %v", e.isiClient.ClusterName, err)
 		return
 	}
-	result = gjson.Get(s, "quotas")
-	result.ForEach(func(key, value gjson.Result) bool {
-		path := gjson.Get(value.String(), "path").String()
-		ch <- prometheus.MustNewConstMetric(pathHardQuota, prometheus.GaugeValue, gjson.Get(value.String(), "thresholds.hard").Float(), e.isiClient.ClusterName, path)
-		ch <- prometheus.MustNewConstMetric(pathAdvisoryQuota, prometheus.GaugeValue, gjson.Get(value.String(), "thresholds.advisory").Float(), e.isiClient.ClusterName, path)
-		ch <- prometheus.MustNewConstMetric(pathLogicalUsed, prometheus.GaugeValue, gjson.Get(value.String(), "usage.logical").Float(), e.isiClient.ClusterName, path)
-		ch <- prometheus.MustNewConstMetric(pathPhysicalUsed, prometheus.GaugeValue, gjson.Get(value.String(), "usage.physical").Float(), e.isiClient.ClusterName, path)
+	for _, v := range nodeStats {
+		node, ok := lnns[v.Get("devid").String()]
+		if !ok {
+			continue
+		}
+		switch v.Get("key").String() {
+		case "node.net.ext.bytes.in":
+			ch <- prometheus.MustNewConstMetric(nodeNetInBytes, prometheus.CounterValue, v.Get("value").Float(), e.isiClient.ClusterName, node)
+		case "node.net.ext.bytes.out":
+			ch <- prometheus.MustNewConstMetric(nodeNetOutBytes, prometheus.CounterValue, v.Get("value").Float(), e.isiClient.ClusterName, node)
+		}
+	}
+}
+
+// currentCounters reads the current values of statistics keys, keyed by key and,
+// for per node values, devid. Keys the cluster does not know or reports without
+// a number are left out.
+func (e *IsiClusterCollector) currentCounters(args url.Values) map[string]gjson.Result {
+	stats := map[string]gjson.Result{}
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/statistics/current?" + args.Encode()
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve cumulative statistics from %s: %v", e.isiClient.ClusterName, err)
+		return stats
+	}
+	gjson.Get(s, "stats").ForEach(func(_, value gjson.Result) bool {
+		if value.Get("value").Type != gjson.Number {
+			return true
+		}
+		key := value.Get("key").String()
+		if args.Get("devid") != "" {
+			key += "/" + value.Get("devid").String()
+		}
+		stats[key] = value
 		return true
 	})
-	duration := float64(time.Since(start).Seconds())
-	ch <- prometheus.MustNewConstMetric(isiCollectionDuration, prometheus.GaugeValue, duration, e.isiClient.ClusterName)
-	ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 1, e.isiClient.ClusterName)
-	log.Debugf("Scrape of target '%s' took %f seconds", e.isiClient.ClusterName, duration)
-	log.Infoln("Cluster exporter finished")
+	return stats
 }
 
 func arrayCount(r gjson.Result) (count float64) {
@@ -340,37 +393,38 @@ func arrayCount(r gjson.Result) (count float64) {
 
 // Describe describes the metrics exported from this collector.
 func (e *IsiClusterCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- exporterUp
+	ch <- ExporterUp
 	ch <- isiClusterInfo
 	ch <- clusterSummaryCPU
 	ch <- isiCollectionDuration
-	ch <- clusterSummaryFTPthroughput
-	ch <- clusterSummaryHTTPthroughput
-	ch <- clusterSummaryHDFSthroughput
-	ch <- clusterSummaryiSCSIthroughput
-	ch <- clusterSummarySMBthroughput
-	ch <- clusterSummaryNFSthroughput
-	ch <- clusterSummaryNetInthroughput
-	ch <- clusterSummaryNetOutthroughput
-	ch <- clusterSummaryNetTotalthroughput
-	ch <- clusterSummaryDiskInthroughput
-	ch <- clusterSummaryDiskOutthroughput
-	ch <- clusterIFSBytesAvail
-	ch <- clusterIFSBytesFree
-	ch <- clusterIFSBytesTotal
-	ch <- clusterSSDIFSBytesAvail
-	ch <- clusterSSDIFSBytesFree
-	ch <- clusterSSDIFSBytesTotal
-	ch <- alertsnumcritical
-	ch <- alertsnumerror
-	ch <- alertsnuminfo
-	ch <- alertsnumwarning
+	if e.rateGauges {
+		ch <- clusterSummaryFTPthroughput
+		ch <- clusterSummaryHTTPthroughput
+		ch <- clusterSummaryHDFSthroughput
+		ch <- clusterSummaryiSCSIthroughput
+		ch <- clusterSummarySMBthroughput
+		ch <- clusterSummaryNFSthroughput
+		ch <- clusterSummaryNetInthroughput
+		ch <- clusterSummaryNetOutthroughput
+		ch <- clusterSummaryNetTotalthroughput
+		ch <- clusterSummaryDiskInthroughput
+		ch <- clusterSummaryDiskOutthroughput
+		ch <- nodeDiskBytesIn
+		ch <- nodeDiskBytesOut
+	}
+	ch <- clusterNetInBytes
+	ch <- clusterNetOutBytes
+	ch <- clusterDiskInBytes
+	ch <- clusterDiskOutBytes
+	ch <- clusterProtocolBytes
+	ch <- clusterProtocolOperations
+	ch <- nodeNetInBytes
+	ch <- nodeNetOutBytes
+	ch <- nodeDiskInBytes
+	ch <- nodeDiskOutBytes
+	for _, d := range clusterSpaceStats {
+		ch <- d.fallback
+	}
 	ch <- nodeDiskBusy
 	ch <- nodeDiskAccessLatency
-	ch <- nodeDiskBytesIn
-	ch <- nodeDiskBytesOut
-	ch <- pathHardQuota
-	ch <- pathAdvisoryQuota
-	ch <- pathLogicalUsed
-	ch <- pathPhysicalUsed
 }
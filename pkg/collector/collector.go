@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// rateCounters turns the averaged rates reported by OneFS into counters for keys
+// without a cumulative equivalent. The counters live across scrapes and are keyed
+// by cluster name and series.
+var rateCounters = struct {
+	sync.Mutex
+	bySeries map[string]*rateCounter
+	// pruned is when counters were last checked for expiry
+	pruned time.Time
+}{bySeries: map[string]*rateCounter{}}
+
+// rateCounterExpiry is how long a counter is kept without being updated, which
+// outlasts several scrape or polling intervals. Counters of replaced drives and
+// of clusters removed from the configuration are dropped after it.
+const rateCounterExpiry = time.Hour
+
+// rateCounter is the running total of a rate
+type rateCounter struct {
+	total float64
+	rate  float64
+	last  time.Time
+}
+
+// ExporterUp reports whether a cluster could be scraped. It is shared by
+// everything reporting a cluster as down, so the metric keeps one help text.
+var ExporterUp = prometheus.NewDesc(
+	prometheus.BuildFQName("emcisi", "exporter", "up"),
+	"Indicates if scrape was successful or not.",
+	[]string{"clustername"}, nil,
+)
+
+// downCollector reports a cluster that can not be scraped
+type downCollector struct {
+	clusterName string
+}
+
+// NewDownCollector returns a collector reporting ExporterUp as 0 for a cluster
+// that can not be scraped.
+func NewDownCollector(clusterName string) prometheus.Collector {
+	return downCollector{clusterName: clusterName}
+}
+
+// Describe implements prometheus.Collector.
+func (d downCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ExporterUp
+}
+
+// Collect implements prometheus.Collector.
+func (d downCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(ExporterUp, prometheus.GaugeValue, 0, d.clusterName)
+}
+
+// newScrapeSuccessDesc returns the descriptor a collector uses to report whether
+// all of its calls against the cluster API succeeded during the last scrape.
+func newScrapeSuccessDesc(subsystem string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", subsystem, "scrape_success"),
+		"Indicates if the "+subsystem+" collector scrape was successful or not.",
+		[]string{"clustername"}, nil,
+	)
+}
+
+// nodeLNNs returns the logical node number of every device id of the cluster.
+// Statistics are reported by devid, while nodes are labeled by lnn.
+func nodeLNNs(c *isiclient.ISIClient) (map[string]string, error) {
+	reqStatusURL := "https://" + c.ClusterAddress + ":8080/platform/1/cluster/config"
+	s, err := c.CallIsiAPI(reqStatusURL, 1)
+	if err != nil {
+		return nil, err
+	}
+	if s == "" {
+		return nil, errors.New("empty cluster configuration")
+	}
+	lnns := map[string]string{}
+	gjson.Get(s, "devices").ForEach(func(key, value gjson.Result) bool {
+		lnns[value.Get("devid").String()] = value.Get("lnn").String()
+		return true
+	})
+	return lnns, nil
+}
+
+// boolToFloat converts a boolean into the 1/0 value used by Prometheus gauges.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// accumulateRate adds the amount a per second rate of the series has moved since
+// it was last seen to its running total and returns the new total. The rate is
+// assumed to change linearly between two observations.
+func accumulateRate(cluster, series string, rate float64) float64 {
+	rateCounters.Lock()
+	defer rateCounters.Unlock()
+	now := time.Now()
+	if now.Sub(rateCounters.pruned) > rateCounterExpiry {
+		for key, c := range rateCounters.bySeries {
+			if now.Sub(c.last) > rateCounterExpiry {
+				delete(rateCounters.bySeries, key)
+			}
+		}
+		rateCounters.pruned = now
+	}
+	key := cluster + "/" + series
+	c, ok := rateCounters.bySeries[key]
+	if !ok {
+		rateCounters.bySeries[key] = &rateCounter{rate: rate, last: now}
+		return 0
+	}
+	if rate >= 0 && c.rate >= 0 {
+		c.total += (c.rate + rate) / 2 * now.Sub(c.last).Seconds()
+	}
+	c.rate, c.last = rate, now
+	return c.total
+}
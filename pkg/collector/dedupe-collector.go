@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+// OneFS statistics keys used for the inline data reduction figures.
+const (
+	dataReduceLogicalKey     = "cluster.data.reduce.logical.data"
+	dataReducePhysicalKey    = "cluster.data.reduce.protected.physical"
+	dataReduceCompressionKey = "cluster.data.reduce.compression.ratio"
+	dataReduceEfficiencyKey  = "cluster.data.reduce.efficiency.ratio"
+	dataReduceRatioKey       = "cluster.data.reduce.ratio"
+)
+
+var (
+	dedupeSavedBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "saved_bytes"),
+		"Logical bytes saved by SmartDedupe.",
+		[]string{"clustername"}, nil,
+	)
+	dedupeEstimatedSavedBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "estimated_saved_bytes"),
+		"Bytes SmartDedupe estimates could be saved by the last assessment.",
+		[]string{"clustername"}, nil,
+	)
+	dedupeLastJobTime = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "last_job_timestamp_seconds"),
+		"Unix time the last dedupe job finished.",
+		[]string{"clustername"}, nil,
+	)
+	dedupeNodepoolLogicalBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "nodepool_logical_bytes"),
+		"Logical bytes written to the node pool before data reduction.",
+		[]string{"clustername", "nodepool"}, nil,
+	)
+	dedupeNodepoolPhysicalBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "nodepool_physical_bytes"),
+		"Physical bytes used on the node pool after data reduction and protection.",
+		[]string{"clustername", "nodepool"}, nil,
+	)
+	dedupeNodepoolEfficiencyRatio = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "dedupe", "nodepool_efficiency_ratio"),
+		"Storage efficiency ratio (logical data versus protected physical data) of the node pool.",
+		[]string{"clustername", "nodepool"}, nil,
+	)
+	dedupeScrapeSuccess = newScrapeSuccessDesc("dedupe")
+)
+
+// dataReductionStats are the cluster wide data reduction statistics keys and their metrics
+var dataReductionStats = map[string]*statisticDesc{
+	dataReduceLogicalKey: newStatisticDesc(dataReduceLogicalKey, prometheus.BuildFQName("emcisi", "dedupe", "logical_bytes"),
+		"Logical bytes written to the cluster before data reduction.", "clustername"),
+	dataReducePhysicalKey: newStatisticDesc(dataReducePhysicalKey, prometheus.BuildFQName("emcisi", "dedupe", "physical_bytes"),
+		"Physical bytes used on the cluster after data reduction and protection.", "clustername"),
+	dataReduceCompressionKey: newStatisticDesc(dataReduceCompressionKey, prometheus.BuildFQName("emcisi", "dedupe", "compression_ratio"),
+		"Inline compression ratio of the cluster.", "clustername"),
+	dataReduceEfficiencyKey: newStatisticDesc(dataReduceEfficiencyKey, prometheus.BuildFQName("emcisi", "dedupe", "efficiency_ratio"),
+		"Storage efficiency ratio (logical data versus protected physical data) of the cluster.", "clustername"),
+	dataReduceRatioKey: newStatisticDesc(dataReduceRatioKey, prometheus.BuildFQName("emcisi", "dedupe", "reduction_ratio"),
+		"Data reduction ratio of the cluster from compression, deduplication and zero block removal.", "clustername"),
+}
+
+// A IsiDedupeCollector implements the prometheus.Collector.
+// It reports the savings of SmartDedupe and inline data reduction.
+type IsiDedupeCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+}
+
+// NewIsiDedupeCollector returns an initialized Isilon Dedupe Collector.
+func NewIsiDedupeCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiDedupeCollector, error) {
+
+	log.Debugln("Init dedupe exporter")
+	return &IsiDedupeCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+	}, nil
+}
+
+// Collect fetches the dedupe and data reduction figures from the Isilon
+// cluster and delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiDedupeCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Dedupe collect starting")
+	success := true
+
+	// SmartDedupe summary, reported in blocks
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/dedupe/dedupe-summary"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve dedupe summary from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		summary := gjson.Get(s, "summary")
+		blockSize := summary.Get("block_size").Float()
+		ch <- prometheus.MustNewConstMetric(dedupeSavedBytes, prometheus.GaugeValue, summary.Get("saved_logical_blocks").Float()*blockSize, e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(dedupeEstimatedSavedBytes, prometheus.GaugeValue, summary.Get("estimated_saved_blocks").Float()*blockSize, e.isiClient.ClusterName)
+	}
+
+	// Time of the last finished dedupe job
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/dedupe/reports"
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve dedupe reports from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		var last float64
+		gjson.Get(s, "reports").ForEach(func(key, value gjson.Result) bool {
+			if t := value.Get("end_time").Float(); t > last {
+				last = t
+			}
+			return true
+		})
+		if last > 0 {
+			ch <- prometheus.MustNewConstMetric(dedupeLastJobTime, prometheus.GaugeValue, last, e.isiClient.ClusterName)
+		}
+	}
+
+	// Inline data reduction statistics. The cluster totals are reported on devid 0,
+	// anything reported per node is summed up into the node pool the node belongs to.
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/statistics/current?key=" + dataReduceLogicalKey +
+		"&key=" + dataReducePhysicalKey + "&key=" + dataReduceCompressionKey + "&key=" + dataReduceEfficiencyKey +
+		"&key=" + dataReduceRatioKey + "&devid=all"
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve data reduction statistics from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else if !e.collectDataReduction(ch, s) {
+		success = false
+	}
+
+	ch <- prometheus.MustNewConstMetric(dedupeScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("Dedupe exporter finished")
+}
+
+// collectDataReduction delivers the cluster wide data reduction statistics and
+// the per node pool totals. It returns false if the node pool layout could not be read.
+func (e *IsiDedupeCollector) collectDataReduction(ch chan<- prometheus.Metric, s string) bool {
+	nodeLogical := map[string]float64{}
+	nodePhysical := map[string]float64{}
+	gjson.Get(s, "stats").ForEach(func(key, value gjson.Result) bool {
+		devid := value.Get("devid").String()
+		v := value.Get("value").Float()
+		if devid != "0" {
+			switch value.Get("key").String() {
+			case dataReduceLogicalKey:
+				nodeLogical[devid] = v
+			case dataReducePhysicalKey:
+				nodePhysical[devid] = v
+			}
+			return true
+		}
+		if d, ok := dataReductionStats[value.Get("key").String()]; ok {
+			ch <- prometheus.MustNewConstMetric(d.desc(e.isiClient), prometheus.GaugeValue, v, e.isiClient.ClusterName)
+		} else {
+			log.Debugf("Unexpected data reduction statistics key %s", value.Get("key").String())
+		}
+		return true
+	})
+
+	if len(nodeLogical) == 0 && len(nodePhysical) == 0 {
+		return true
+	}
+	return e.collectNodepools(ch, nodeLogical, nodePhysical)
+}
+
+// collectNodepools sums up the per node data reduction figures into the node
+// pools of the cluster. It returns false if the pool layout could not be read.
+func (e *IsiDedupeCollector) collectNodepools(ch chan<- prometheus.Metric, nodeLogical, nodePhysical map[string]float64) bool {
+	// Statistics are reported by devid while node pools list their members by lnn
+	lnns, err := nodeLNNs(e.isiClient)
+	if err != nil {
+		log.Infof("Unable to retrieve cluster devices from %s: %v", e.isiClient.ClusterName, err)
+		return false
+	}
+	devids := map[string]string{}
+	for devid, lnn := range lnns {
+		devids[lnn] = devid
+	}
+
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/storagepool/nodepools"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve node pools from %s: %v", e.isiClient.ClusterName, err)
+		return false
+	}
+	gjson.Get(s, "nodepools").ForEach(func(key, value gjson.Result) bool {
+		pool := value.Get("name").String()
+		var logical, physical float64
+		value.Get("lnns").ForEach(func(_, lnn gjson.Result) bool {
+			devid, ok := devids[lnn.String()]
+			if !ok {
+				devid = strconv.FormatInt(lnn.Int(), 10)
+			}
+			logical += nodeLogical[devid]
+			physical += nodePhysical[devid]
+			return true
+		})
+		ch <- prometheus.MustNewConstMetric(dedupeNodepoolLogicalBytes, prometheus.GaugeValue, logical, e.isiClient.ClusterName, pool)
+		ch <- prometheus.MustNewConstMetric(dedupeNodepoolPhysicalBytes, prometheus.GaugeValue, physical, e.isiClient.ClusterName, pool)
+		if physical > 0 {
+			ch <- prometheus.MustNewConstMetric(dedupeNodepoolEfficiencyRatio, prometheus.GaugeValue, logical/physical, e.isiClient.ClusterName, pool)
+		}
+		return true
+	})
+	return true
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiDedupeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dedupeSavedBytes
+	ch <- dedupeEstimatedSavedBytes
+	for _, d := range dataReductionStats {
+		ch <- d.fallback
+	}
+	ch <- dedupeLastJobTime
+	ch <- dedupeNodepoolLogicalBytes
+	ch <- dedupeNodepoolPhysicalBytes
+	ch <- dedupeNodepoolEfficiencyRatio
+	ch <- dedupeScrapeSuccess
+}
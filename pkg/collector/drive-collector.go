@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	driveStatus = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "drive", "status"),
+		"A metric with a constant '1' value labeled by the state reported for each drive.",
+		[]string{"clustername", "node", "bay", "state"}, nil,
+	)
+	driveHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "drive", "healthy"),
+		"Indicates if the drive reports itself as healthy (1) or not (0).",
+		[]string{"clustername", "node", "bay"}, nil,
+	)
+	driveScrapeSuccess = newScrapeSuccessDesc("drive")
+)
+
+// healthyDriveStates are the drive states OneFS reports for drives in service.
+// Empty bays are not reported at all.
+var healthyDriveStates = map[string]bool{
+	"healthy": true,
+	"l3":      true,
+}
+
+// A IsiDriveCollector implements the prometheus.Collector.
+// It reports the state and health of every drive of the cluster.
+type IsiDriveCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+}
+
+// NewIsiDriveCollector returns an initialized Isilon Drive Collector.
+func NewIsiDriveCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiDriveCollector, error) {
+
+	log.Debugln("Init drive exporter")
+	return &IsiDriveCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+	}, nil
+}
+
+// Collect fetches the drives of every node from the Isilon cluster and
+// delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiDriveCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Drive collect starting")
+
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/cluster/nodes"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve drives from %s: %v", e.isiClient.ClusterName, err)
+		ch <- prometheus.MustNewConstMetric(driveScrapeSuccess, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		return
+	}
+	gjson.Get(s, "nodes").ForEach(func(key, value gjson.Result) bool {
+		node := value.Get("lnn").String()
+		if node == "" {
+			node = value.Get("id").String()
+		}
+		value.Get("drives").ForEach(func(key, drive gjson.Result) bool {
+			state := strings.ToLower(drive.Get("ui_state").String())
+			if state == "empty" {
+				return true
+			}
+			bay := drive.Get("bay").String()
+			ch <- prometheus.MustNewConstMetric(driveStatus, prometheus.GaugeValue, 1, e.isiClient.ClusterName, node, bay, state)
+			ch <- prometheus.MustNewConstMetric(driveHealthy, prometheus.GaugeValue, boolToFloat(healthyDriveStates[state]), e.isiClient.ClusterName, node, bay)
+			return true
+		})
+		return true
+	})
+
+	ch <- prometheus.MustNewConstMetric(driveScrapeSuccess, prometheus.GaugeValue, 1, e.isiClient.ClusterName)
+	log.Debugln("Drive exporter finished")
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiDriveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- driveStatus
+	ch <- driveHealthy
+	ch <- driveScrapeSuccess
+}
@@ -0,0 +1,235 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+// defaultMaxActiveInfo is the number of event info series exported when max_active_info is not set
+const defaultMaxActiveInfo = 100
+
+// severityRank orders the OneFS event severities, most severe first
+var severityRank = map[string]int{
+	"emergency":   0,
+	"critical":    1,
+	"error":       2,
+	"warning":     3,
+	"information": 4,
+}
+
+var (
+	alertsnumcritical = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "alerts_critical"),
+		"Number of current critical and emergency alerts for the cluster",
+		[]string{"clustername"}, nil,
+	)
+	alertsnumerror = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "alerts_error"),
+		"Number of current error alerts for the cluster",
+		[]string{"clustername"}, nil,
+	)
+	alertsnuminfo = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "alerts_info"),
+		"Number of current info alerts for the cluster",
+		[]string{"clustername"}, nil,
+	)
+	alertsnumwarning = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "alerts_warning"),
+		"Number of current warning alerts for the cluster",
+		[]string{"clustername"}, nil,
+	)
+	eventGroups = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "event", "groups"),
+		"Number of unresolved event groups by severity, category and node.",
+		[]string{"clustername", "severity", "category", "node"}, nil,
+	)
+	eventActiveInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "event", "active_info"),
+		"A metric with a constant '1' value labeled by each unresolved event group.",
+		[]string{"clustername", "id", "severity", "message", "node"}, nil,
+	)
+	eventOldestCriticalAge = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "event", "oldest_critical_age_seconds"),
+		"Age in seconds of the oldest unresolved critical or emergency event group, 0 if there is none.",
+		[]string{"clustername"}, nil,
+	)
+	eventScrapeSuccess = newScrapeSuccessDesc("event")
+)
+
+// A IsiEventCollector implements the prometheus.Collector.
+// It reports the unresolved event groups of the cluster.
+type IsiEventCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+	config    isiconfig.EventConfig
+}
+
+// NewIsiEventCollector returns an initialized Isilon Event Collector.
+func NewIsiEventCollector(emcisi *isiclient.ISIClient, namespace string, config isiconfig.EventConfig) (*IsiEventCollector, error) {
+
+	log.Debugln("Init event exporter")
+	return &IsiEventCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+		config:    config,
+	}, nil
+}
+
+// Collect fetches the unresolved event groups from the Isilon cluster and
+// delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiEventCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Event collect starting")
+
+	groups, err := ActiveEventGroups(e.isiClient)
+	if err != nil {
+		log.Infof("Unable to retrieve event groups from %s: %s", e.isiClient.ClusterName, err)
+		ch <- prometheus.MustNewConstMetric(eventScrapeSuccess, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		return
+	}
+
+	type groupKey struct{ severity, category, node string }
+	counts := map[groupKey]float64{}
+	severities := map[string]float64{}
+	var oldestCritical int64
+	for _, g := range groups {
+		counts[groupKey{g.Severity, g.Category, g.Node}]++
+		severities[g.Severity]++
+		if (g.Severity == "critical" || g.Severity == "emergency") && g.Noticed > 0 && (oldestCritical == 0 || g.Noticed < oldestCritical) {
+			oldestCritical = g.Noticed
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(alertsnumwarning, prometheus.GaugeValue, severities["warning"], e.isiClient.ClusterName)
+	ch <- prometheus.MustNewConstMetric(alertsnuminfo, prometheus.GaugeValue, severities["information"], e.isiClient.ClusterName)
+	ch <- prometheus.MustNewConstMetric(alertsnumerror, prometheus.GaugeValue, severities["error"], e.isiClient.ClusterName)
+	ch <- prometheus.MustNewConstMetric(alertsnumcritical, prometheus.GaugeValue, severities["critical"]+severities["emergency"], e.isiClient.ClusterName)
+	for k, v := range counts {
+		ch <- prometheus.MustNewConstMetric(eventGroups, prometheus.GaugeValue, v, e.isiClient.ClusterName, k.severity, k.category, k.node)
+	}
+
+	var age float64
+	if oldestCritical > 0 {
+		age = time.Since(time.Unix(oldestCritical, 0)).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(eventOldestCriticalAge, prometheus.GaugeValue, age, e.isiClient.ClusterName)
+
+	if e.config.ActiveInfo {
+		max := e.config.MaxActiveInfo
+		if max == 0 {
+			max = defaultMaxActiveInfo
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			ri, rj := RankSeverity(groups[i].Severity), RankSeverity(groups[j].Severity)
+			if ri != rj {
+				return ri < rj
+			}
+			return groups[i].Noticed > groups[j].Noticed
+		})
+		if len(groups) > max {
+			groups = groups[:max]
+		}
+		for _, g := range groups {
+			ch <- prometheus.MustNewConstMetric(eventActiveInfo, prometheus.GaugeValue, 1, e.isiClient.ClusterName, g.ID, g.Severity, g.Message, g.Node)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(eventScrapeSuccess, prometheus.GaugeValue, 1, e.isiClient.ClusterName)
+	log.Debugln("Event exporter finished")
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiEventCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- alertsnumcritical
+	ch <- alertsnumerror
+	ch <- alertsnuminfo
+	ch <- alertsnumwarning
+	ch <- eventGroups
+	ch <- eventActiveInfo
+	ch <- eventOldestCriticalAge
+	ch <- eventScrapeSuccess
+}
+
+// EventGroup is an unresolved OneFS event group occurrence
+type EventGroup struct {
+	ID       string
+	Severity string
+	Category string
+	Node     string
+	Message  string
+	// Noticed is the unix time the event group was first noticed
+	Noticed int64
+}
+
+// ActiveEventGroups returns every unresolved and not ignored event group of the cluster.
+func ActiveEventGroups(c *isiclient.ISIClient) ([]EventGroup, error) {
+	reqStatusURL := "https://" + c.ClusterAddress + ":8080/platform/3/event/eventgroup-occurrences?resolved=false&ignore=false"
+	pages, err := c.CallIsiAPIPages(reqStatusURL, 1)
+	if err != nil {
+		return nil, err
+	}
+	var groups []EventGroup
+	for _, page := range pages {
+		gjson.Get(page, "eventgroups").ForEach(func(key, value gjson.Result) bool {
+			groups = append(groups, EventGroup{
+				ID:       value.Get("id").String(),
+				Severity: strings.ToLower(value.Get("severity").String()),
+				Category: eventCategory(value),
+				Node:     eventNode(value),
+				Message:  eventMessage(value),
+				Noticed:  value.Get("time_noticed").Int(),
+			})
+			return true
+		})
+	}
+	return groups, nil
+}
+
+// eventCategory returns the category of an event group. Older OneFS releases do
+// not report it, in which case it is derived from the event type id whose leading
+// three digits identify the category (e.g. 100010001 belongs to 100000000).
+func eventCategory(value gjson.Result) string {
+	if c := value.Get("category").String(); c != "" {
+		return c
+	}
+	id := value.Get("causes.0.0").String()
+	if len(id) == 9 {
+		return id[:3] + "000000"
+	}
+	return ""
+}
+
+// eventNode returns the logical node number the event group was raised on, or
+// an empty string for cluster wide events.
+func eventNode(value gjson.Result) string {
+	if lnn := value.Get("lnn"); lnn.Exists() && lnn.Type != gjson.Null {
+		return lnn.String()
+	}
+	if devid := value.Get("devid"); devid.Exists() && devid.Type != gjson.Null {
+		return devid.String()
+	}
+	return ""
+}
+
+// eventMessage returns the message of the event group, falling back to its first cause.
+func eventMessage(value gjson.Result) string {
+	if m := value.Get("message").String(); m != "" {
+		return m
+	}
+	return value.Get("causes.0.1").String()
+}
+
+// RankSeverity returns the sort rank of a severity, unknown severities sort last
+func RankSeverity(severity string) int {
+	if r, ok := severityRank[severity]; ok {
+		return r
+	}
+	return len(severityRank)
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"strings"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	healthClusterStatus = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "cluster_status"),
+		"A metric with a constant '1' value labeled by the overall health reported by the cluster.",
+		[]string{"clustername", "health"}, nil,
+	)
+	healthClusterHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "cluster_healthy"),
+		"Indicates if the cluster reports itself as healthy (1) or not (0).",
+		[]string{"clustername"}, nil,
+	)
+	healthClusterQuorate = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "cluster_quorate"),
+		"Indicates if the cluster has quorum (1) or not (0).",
+		[]string{"clustername"}, nil,
+	)
+	healthNodeStatus = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "node_status"),
+		"A metric with a constant '1' value labeled by the health reported for each node.",
+		[]string{"clustername", "node", "health"}, nil,
+	)
+	healthNodeHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "node_healthy"),
+		"Indicates if the node reports itself as healthy (1) or not (0).",
+		[]string{"clustername", "node"}, nil,
+	)
+	healthNodeClockOffset = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "node_clock_offset_seconds"),
+		"Difference between the node clock and the exporter clock in seconds. Positive values mean the node is ahead.",
+		[]string{"clustername", "node"}, nil,
+	)
+	healthNTPServer = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "ntp_server_info"),
+		"A metric with a constant '1' value labeled by each NTP server configured on the cluster.",
+		[]string{"clustername", "server"}, nil,
+	)
+	healthNTPServers = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "health", "ntp_servers"),
+		"Number of NTP servers configured on the cluster.",
+		[]string{"clustername"}, nil,
+	)
+	healthScrapeSuccess = newScrapeSuccessDesc("health")
+)
+
+// healthyStatus is the value OneFS reports for a cluster or node with no issues.
+const healthyStatus = "ok"
+
+// A IsiHealthCollector implements the prometheus.Collector.
+// It reports cluster and node health, quorum and clock skew.
+type IsiHealthCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+}
+
+// NewIsiHealthCollector returns an initialized Isilon Health Collector.
+func NewIsiHealthCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiHealthCollector, error) {
+
+	log.Debugln("Init health exporter")
+	return &IsiHealthCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+	}, nil
+}
+
+// Collect fetches the health, time and NTP settings from the Isilon cluster
+// and delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Health collect starting")
+	success := true
+
+	// Cluster and node health
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/cluster/status"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve cluster status from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		status := gjson.Get(s, "status")
+		if !status.Exists() {
+			status = gjson.Parse(s)
+		}
+
+		health := strings.ToLower(status.Get("health").String())
+		ch <- prometheus.MustNewConstMetric(healthClusterStatus, prometheus.GaugeValue, 1, e.isiClient.ClusterName, health)
+		ch <- prometheus.MustNewConstMetric(healthClusterHealthy, prometheus.GaugeValue, boolToFloat(health == healthyStatus), e.isiClient.ClusterName)
+
+		var total, up float64
+		status.Get("nodes").ForEach(func(key, value gjson.Result) bool {
+			node := value.Get("lnn").String()
+			if node == "" {
+				node = value.Get("id").String()
+			}
+			nodeHealth := strings.ToLower(value.Get("health").String())
+			ch <- prometheus.MustNewConstMetric(healthNodeStatus, prometheus.GaugeValue, 1, e.isiClient.ClusterName, node, nodeHealth)
+			ch <- prometheus.MustNewConstMetric(healthNodeHealthy, prometheus.GaugeValue, boolToFloat(nodeHealth == healthyStatus), e.isiClient.ClusterName, node)
+			total++
+			if nodeHealth != "down" {
+				up++
+			}
+			return true
+		})
+
+		// Prefer what the cluster tells us, otherwise fall back to a simple majority of reachable nodes
+		quorate := up > total/2
+		if q := status.Get("quorum"); q.Exists() {
+			quorate = q.Bool()
+		}
+		ch <- prometheus.MustNewConstMetric(healthClusterQuorate, prometheus.GaugeValue, boolToFloat(quorate), e.isiClient.ClusterName)
+	}
+
+	// Per-node clock offset. We compare against the midpoint of the request to
+	// take the API latency out of the measurement as much as possible.
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/cluster/time"
+	before := time.Now()
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	after := time.Now()
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve cluster time from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		now := float64(before.Add(after.Sub(before)/2).UnixNano()) / 1e9
+		nodes := gjson.Get(s, "nodes")
+		if !nodes.Exists() {
+			nodes = gjson.Get(s, "time.nodes")
+		}
+		nodes.ForEach(func(key, value gjson.Result) bool {
+			node := value.Get("lnn").String()
+			if node == "" {
+				node = value.Get("id").String()
+			}
+			ch <- prometheus.MustNewConstMetric(healthNodeClockOffset, prometheus.GaugeValue, value.Get("time").Float()-now, e.isiClient.ClusterName, node)
+			return true
+		})
+	}
+
+	// Configured NTP servers
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/protocols/ntp/servers"
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve NTP servers from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		result := gjson.Get(s, "servers")
+		result.ForEach(func(key, value gjson.Result) bool {
+			server := value.Get("name").String()
+			if server == "" {
+				server = value.Get("id").String()
+			}
+			ch <- prometheus.MustNewConstMetric(healthNTPServer, prometheus.GaugeValue, 1, e.isiClient.ClusterName, server)
+			return true
+		})
+		ch <- prometheus.MustNewConstMetric(healthNTPServers, prometheus.GaugeValue, arrayCount(result), e.isiClient.ClusterName)
+	}
+
+	ch <- prometheus.MustNewConstMetric(healthScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("Health exporter finished")
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- healthClusterStatus
+	ch <- healthClusterHealthy
+	ch <- healthClusterQuorate
+	ch <- healthNodeStatus
+	ch <- healthNodeHealthy
+	ch <- healthNodeClockOffset
+	ch <- healthNTPServer
+	ch <- healthNTPServers
+	ch <- healthScrapeSuccess
+}
@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+// historySeries is a metric the live collectors export from a statistics key
+type historySeries struct {
+	key   string
+	devid string
+	desc  *prometheus.Desc
+	// perNode adds the devid as node label after the cluster name
+	perNode bool
+	// labels are the remaining label values
+	labels    []string
+	valueType prometheus.ValueType
+	scale     float64
+}
+
+// historySeriesOf lists the statistics backed metrics of the live collectors
+// for a cluster with the given statistics configuration.
+func historySeriesOf(c *isiclient.ISIClient, statistics []isiconfig.StatisticConfig) ([]historySeries, error) {
+	var series []historySeries
+	for key, d := range clusterSpaceStats {
+		series = append(series, historySeries{key: key, desc: d.desc(c), valueType: prometheus.GaugeValue, scale: 1})
+	}
+	for _, bc := range clusterByteCounters {
+		series = append(series, historySeries{key: bc.key, desc: bc.desc, valueType: prometheus.CounterValue, scale: 1})
+	}
+	for _, p := range throughputProtocols {
+		series = append(series, historySeries{key: "cluster.protostats." + p + ".total", desc: clusterProtocolOperations, labels: []string{p}, valueType: prometheus.CounterValue, scale: 1})
+	}
+	series = append(series,
+		historySeries{key: "node.net.ext.bytes.in", devid: "all", desc: nodeNetInBytes, perNode: true, valueType: prometheus.CounterValue, scale: 1},
+		historySeries{key: "node.net.ext.bytes.out", devid: "all", desc: nodeNetOutBytes, perNode: true, valueType: prometheus.CounterValue, scale: 1},
+	)
+	for key, d := range dataReductionStats {
+		series = append(series, historySeries{key: key, desc: d.desc(c), valueType: prometheus.GaugeValue, scale: 1})
+	}
+
+	if len(statistics) == 0 {
+		return series, nil
+	}
+	metrics, err := (&IsiStatisticsCollector{isiClient: c, statistics: statistics}).resolve()
+	for devid, list := range metrics {
+		for _, m := range list {
+			hs := historySeries{key: m.key, devid: devid, desc: m.desc, perNode: m.perNode, valueType: m.valueType, scale: m.scale}
+			if m.withKey {
+				hs.labels = []string{m.key}
+			}
+			series = append(series, hs)
+		}
+	}
+	return series, err
+}
+
+// History reads the statistics history of the cluster between begin and end,
+// sampled every interval, and returns it as the metric families the live
+// collectors export, each sample carrying its timestamp.
+func History(c *isiclient.ISIClient, statistics []isiconfig.StatisticConfig, begin, end time.Time, interval time.Duration) ([]*dto.MetricFamily, error) {
+	series, err := historySeriesOf(c, statistics)
+	if err != nil {
+		return nil, err
+	}
+
+	// Batch the keys up per devid scope, one call per batch
+	byDevid := map[string][]string{}
+	byKey := map[string][]historySeries{}
+	for _, hs := range series {
+		if _, ok := byKey[hs.devid+"/"+hs.key]; !ok {
+			byDevid[hs.devid] = append(byDevid[hs.devid], hs.key)
+		}
+		byKey[hs.devid+"/"+hs.key] = append(byKey[hs.devid+"/"+hs.key], hs)
+	}
+
+	samples := map[int64][]prometheus.Metric{}
+	for devid, keys := range byDevid {
+		for len(keys) > 0 {
+			n := statisticsBatchSize
+			if len(keys) < n {
+				n = len(keys)
+			}
+			batch := keys[:n]
+			keys = keys[n:]
+
+			args := url.Values{
+				"key":      batch,
+				"begin":    []string{strconv.FormatInt(begin.Unix(), 10)},
+				"end":      []string{strconv.FormatInt(end.Unix(), 10)},
+				"interval": []string{strconv.FormatInt(int64(interval/time.Second), 10)},
+				"degraded": []string{"true"},
+			}
+			for _, d := range strings.Split(devid, ",") {
+				if d != "" {
+					args.Add("devid", d)
+				}
+			}
+			reqStatusURL := "https://" + c.ClusterAddress + ":8080/platform/1/statistics/history?" + args.Encode()
+			s, err := c.CallIsiAPI(reqStatusURL, 1)
+			if err != nil {
+				return nil, err
+			}
+			if s == "" {
+				return nil, fmt.Errorf("unable to retrieve statistics history from %s", c.ClusterName)
+			}
+			gjson.Get(s, "stats").ForEach(func(_, stat gjson.Result) bool {
+				key := stat.Get("key").String()
+				node := stat.Get("devid").String()
+				stat.Get("values").ForEach(func(_, value gjson.Result) bool {
+					t, v := historyValue(value)
+					if v.Type != gjson.Number {
+						return true
+					}
+					for _, hs := range byKey[devid+"/"+key] {
+						labels := []string{c.ClusterName}
+						if hs.perNode {
+							labels = append(labels, node)
+						}
+						labels = append(labels, hs.labels...)
+						samples[t] = append(samples[t], prometheus.MustNewConstMetric(hs.desc, hs.valueType, v.Float()*hs.scale, labels...))
+					}
+					return true
+				})
+				return true
+			})
+		}
+	}
+	log.Debugf("Read %d points in time of statistics history from %s", len(samples), c.ClusterName)
+	return timestampFamilies(samples)
+}
+
+// historyValue returns the time and value of a history sample, which OneFS
+// reports either as a [time, value] pair or as an object.
+func historyValue(value gjson.Result) (int64, gjson.Result) {
+	if value.IsArray() {
+		return value.Get("0").Int(), value.Get("1")
+	}
+	return value.Get("time").Int(), value.Get("value")
+}
+
+// timestampFamilies gathers the metrics of each point in time into metric
+// families, so the samples get the same names, help and labels as on a live
+// scrape, and merges them into one family per metric.
+func timestampFamilies(samples map[int64][]prometheus.Metric) ([]*dto.MetricFamily, error) {
+	times := make([]int64, 0, len(samples))
+	for t := range samples {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	byName := map[string]*dto.MetricFamily{}
+	for _, t := range times {
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(constCollector(samples[t])); err != nil {
+			return nil, err
+		}
+		families, err := registry.Gather()
+		if err != nil {
+			return nil, fmt.Errorf("samples at %s: %s", time.Unix(t, 0).UTC().Format(time.RFC3339), err)
+		}
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				m.TimestampMs = proto.Int64(t * 1000)
+			}
+			if existing, ok := byName[mf.GetName()]; ok {
+				existing.Metric = append(existing.Metric, mf.Metric...)
+			} else {
+				byName[mf.GetName()] = mf
+			}
+		}
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		families = append(families, mf)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families, nil
+}
+
+// constCollector delivers a fixed set of metrics
+type constCollector []prometheus.Metric
+
+// Collect implements prometheus.Collector.
+func (c constCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c constCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c {
+		ch <- m.Desc()
+	}
+}
@@ -0,0 +1,384 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+// quotaLabels are the labels identifying a single quota. The path alone is not
+// unique as directory, user and group quotas can all be set on the same path.
+var quotaLabels = []string{"clustername", "path", "type", "persona", "zone", "enforced", "include_snapshots"}
+
+// quotaAggregateLabels are the labels of quotas summed up per path prefix.
+var quotaAggregateLabels = []string{"clustername", "path", "type", "zone"}
+
+var (
+	pathHardQuota = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "hard_quota"),
+		"HardQuota of a path bytes",
+		quotaLabels, nil,
+	)
+	pathSoftQuota = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "soft_quota"),
+		"Soft Quota of a path bytes",
+		quotaLabels, nil,
+	)
+	pathAdvisoryQuota = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "advisory_quota"),
+		"Advisory Quota of a path bytes",
+		quotaLabels, nil,
+	)
+	pathLogicalUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "logical_used"),
+		"Used data w/o overhead of a path bytes",
+		quotaLabels, nil,
+	)
+	pathPhysicalUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "cluster", "physical_used"),
+		"Used Data w/overhead of a path bytes",
+		quotaLabels, nil,
+	)
+	quotaInodesUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "inodes_used"),
+		"Number of files and directories counted against the quota.",
+		quotaLabels, nil,
+	)
+	quotaSoftGrace = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "soft_grace_seconds"),
+		"Time in seconds usage may stay above the soft quota before it is enforced.",
+		quotaLabels, nil,
+	)
+	quotaSoftExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "soft_exceeded"),
+		"Indicates if usage is above the soft quota (1) or not (0).",
+		quotaLabels, nil,
+	)
+	quotaHardExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "hard_exceeded"),
+		"Indicates if usage has reached the hard quota (1) or not (0).",
+		quotaLabels, nil,
+	)
+	quotaAdvisoryExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "advisory_exceeded"),
+		"Indicates if usage is above the advisory quota (1) or not (0).",
+		quotaLabels, nil,
+	)
+	quotaSoftLastExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "soft_last_exceeded_timestamp_seconds"),
+		"Unix time usage last went above the soft quota.",
+		quotaLabels, nil,
+	)
+	quotaHardLastExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "hard_last_exceeded_timestamp_seconds"),
+		"Unix time usage last reached the hard quota.",
+		quotaLabels, nil,
+	)
+	quotaAdvisoryLastExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "advisory_last_exceeded_timestamp_seconds"),
+		"Unix time usage last went above the advisory quota.",
+		quotaLabels, nil,
+	)
+	quotaOver = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "over_timestamp_seconds"),
+		"Unix time the soft grace period of an exceeded soft quota runs out and writes are denied.",
+		quotaLabels, nil,
+	)
+	quotaAggregateQuotas = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_quotas"),
+		"Number of quotas summed up under the path prefix.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregateHardQuota = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_hard_quota"),
+		"Sum of the hard quotas under the path prefix in bytes.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregateLogicalUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_logical_used"),
+		"Sum of the used data w/o overhead of the quotas under the path prefix in bytes.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregatePhysicalUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_physical_used"),
+		"Sum of the used data w/overhead of the quotas under the path prefix in bytes.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregateInodesUsed = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_inodes_used"),
+		"Sum of the files and directories counted against the quotas under the path prefix.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregateSoftExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_soft_exceeded"),
+		"Number of quotas under the path prefix whose usage is above the soft quota.",
+		quotaAggregateLabels, nil,
+	)
+	quotaAggregateHardExceeded = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "quota", "aggregate_hard_exceeded"),
+		"Number of quotas under the path prefix whose usage has reached the hard quota.",
+		quotaAggregateLabels, nil,
+	)
+	quotaScrapeSuccess = newScrapeSuccessDesc("quota")
+
+	// quotaSeriesDropped lives outside of the collector so the count survives
+	// the per request collectors of the multi query mode.
+	quotaSeriesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: prometheus.BuildFQName("emcisi", "quota", "series_dropped"),
+			Help: "Number of quota series not exported because max_series was reached.",
+		},
+		[]string{"clustername"},
+	)
+)
+
+// quotaAggregate holds the totals of the quotas under one path prefix
+type quotaAggregate struct {
+	labels       []string
+	quotas       float64
+	hard         float64
+	logical      float64
+	physical     float64
+	inodes       float64
+	softExceeded float64
+	hardExceeded float64
+}
+
+// quotaGroup holds the series of a quota or path prefix, ordered by key
+type quotaGroup struct {
+	key     string
+	metrics []prometheus.Metric
+}
+
+// A IsiQuotaCollector implements the prometheus.Collector.
+// It reports the thresholds and usage of every SmartQuota on the cluster.
+type IsiQuotaCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+	config    isiconfig.QuotaConfig
+}
+
+// NewIsiQuotaCollector returns an initialized Isilon Quota Collector.
+func NewIsiQuotaCollector(emcisi *isiclient.ISIClient, namespace string, config isiconfig.QuotaConfig) (*IsiQuotaCollector, error) {
+
+	log.Debugln("Init quota exporter")
+	return &IsiQuotaCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+		config:    config,
+	}, nil
+}
+
+// Collect fetches the quotas from the Isilon cluster and delivers them
+// as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiQuotaCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Quota collect starting")
+	success := true
+
+	// Quotas do not carry their access zone, so work it out from the zone base paths
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/zones"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	zones := map[string]string{}
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve access zones from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		gjson.Get(s, "zones").ForEach(func(key, value gjson.Result) bool {
+			zones[value.Get("path").String()] = value.Get("name").String()
+			return true
+		})
+	}
+
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/quota/quotas"
+	pages, err := e.isiClient.CallIsiAPIPages(reqStatusURL, 1)
+	if err != nil {
+		log.Infof("Unable to retrieve quotas from %s: %v", e.isiClient.ClusterName, err)
+		ch <- prometheus.MustNewConstMetric(quotaScrapeSuccess, prometheus.GaugeValue, 0, e.isiClient.ClusterName)
+		return
+	}
+	// Series are kept together per quota (or prefix) so max_series never exports half a quota
+	var groups []quotaGroup
+	aggregates := map[string]*quotaAggregate{}
+	for _, page := range pages {
+		gjson.Get(page, "quotas").ForEach(func(key, value gjson.Result) bool {
+			path := value.Get("path").String()
+			quotaType := value.Get("type").String()
+			persona := personaName(value.Get("persona"))
+			if !e.config.Wants(quotaType, path, persona) {
+				return true
+			}
+			if e.config.AggregateDepth > 0 {
+				e.aggregateQuota(aggregates, value, zones)
+			} else {
+				key := path + "\x00" + quotaType + "\x00" + persona
+				groups = append(groups, quotaGroup{key: key, metrics: e.quotaMetrics(value, zones)})
+			}
+			return true
+		})
+	}
+	for key, a := range aggregates {
+		groups = append(groups, quotaGroup{key: key, metrics: a.metrics()})
+	}
+	// Keep the same quotas on every scrape when max_series drops some
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].key < groups[j].key })
+
+	var series, dropped int
+	for _, group := range groups {
+		if e.config.MaxSeries > 0 && series+len(group.metrics) > e.config.MaxSeries {
+			dropped += len(group.metrics)
+			continue
+		}
+		series += len(group.metrics)
+		for _, m := range group.metrics {
+			ch <- m
+		}
+	}
+	if dropped > 0 {
+		log.Infof("Dropped %d quota series from %s, max_series is %d", dropped, e.isiClient.ClusterName, e.config.MaxSeries)
+		quotaSeriesDropped.WithLabelValues(e.isiClient.ClusterName).Add(float64(dropped))
+	}
+
+	ch <- quotaSeriesDropped.WithLabelValues(e.isiClient.ClusterName)
+	ch <- prometheus.MustNewConstMetric(quotaScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("Quota exporter finished")
+}
+
+// quotaMetrics returns the metrics of a single quota.
+func (e *IsiQuotaCollector) quotaMetrics(quota gjson.Result, zones map[string]string) (metrics []prometheus.Metric) {
+	path := quota.Get("path").String()
+	labels := []string{
+		e.isiClient.ClusterName,
+		path,
+		quota.Get("type").String(),
+		personaName(quota.Get("persona")),
+		zoneForPath(path, zones),
+		strconv.FormatBool(quota.Get("enforced").Bool()),
+		strconv.FormatBool(quota.Get("include_snapshots").Bool()),
+	}
+	gauge := func(desc *prometheus.Desc, v float64) {
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...))
+	}
+
+	// Unset thresholds come back as null, which means there is no limit at all
+	thresholds := quota.Get("thresholds")
+	optional := func(desc *prometheus.Desc, r gjson.Result) {
+		if r.Exists() && r.Type != gjson.Null {
+			gauge(desc, r.Float())
+		}
+	}
+	optional(pathHardQuota, thresholds.Get("hard"))
+	optional(pathSoftQuota, thresholds.Get("soft"))
+	optional(pathAdvisoryQuota, thresholds.Get("advisory"))
+	optional(quotaSoftGrace, thresholds.Get("soft_grace"))
+	optional(quotaSoftLastExceeded, thresholds.Get("soft_last_exceeded"))
+	optional(quotaHardLastExceeded, thresholds.Get("hard_last_exceeded"))
+	optional(quotaAdvisoryLastExceeded, thresholds.Get("advisory_last_exceeded"))
+	gauge(quotaSoftExceeded, boolToFloat(thresholds.Get("soft_exceeded").Bool()))
+	gauge(quotaHardExceeded, boolToFloat(thresholds.Get("hard_exceeded").Bool()))
+	gauge(quotaAdvisoryExceeded, boolToFloat(thresholds.Get("advisory_exceeded").Bool()))
+	if thresholds.Get("soft_exceeded").Bool() && thresholds.Get("soft_last_exceeded").Int() > 0 {
+		gauge(quotaOver, thresholds.Get("soft_last_exceeded").Float()+thresholds.Get("soft_grace").Float())
+	}
+
+	usage := quota.Get("usage")
+	gauge(pathLogicalUsed, usage.Get("logical").Float())
+	gauge(pathPhysicalUsed, usage.Get("physical").Float())
+	gauge(quotaInodesUsed, usage.Get("inodes").Float())
+	return metrics
+}
+
+// aggregateQuota adds a quota to the totals of its path prefix.
+func (e *IsiQuotaCollector) aggregateQuota(aggregates map[string]*quotaAggregate, quota gjson.Result, zones map[string]string) {
+	prefix := pathPrefix(quota.Get("path").String(), e.config.AggregateDepth)
+	quotaType := quota.Get("type").String()
+	key := prefix + "\x00" + quotaType
+	a, ok := aggregates[key]
+	if !ok {
+		a = &quotaAggregate{labels: []string{e.isiClient.ClusterName, prefix, quotaType, zoneForPath(prefix, zones)}}
+		aggregates[key] = a
+	}
+	a.quotas++
+	a.hard += quota.Get("thresholds.hard").Float()
+	a.logical += quota.Get("usage.logical").Float()
+	a.physical += quota.Get("usage.physical").Float()
+	a.inodes += quota.Get("usage.inodes").Float()
+	a.softExceeded += boolToFloat(quota.Get("thresholds.soft_exceeded").Bool())
+	a.hardExceeded += boolToFloat(quota.Get("thresholds.hard_exceeded").Bool())
+}
+
+// metrics returns the metrics of the totals of a path prefix.
+func (a *quotaAggregate) metrics() []prometheus.Metric {
+	return []prometheus.Metric{
+		prometheus.MustNewConstMetric(quotaAggregateQuotas, prometheus.GaugeValue, a.quotas, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregateHardQuota, prometheus.GaugeValue, a.hard, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregateLogicalUsed, prometheus.GaugeValue, a.logical, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregatePhysicalUsed, prometheus.GaugeValue, a.physical, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregateInodesUsed, prometheus.GaugeValue, a.inodes, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregateSoftExceeded, prometheus.GaugeValue, a.softExceeded, a.labels...),
+		prometheus.MustNewConstMetric(quotaAggregateHardExceeded, prometheus.GaugeValue, a.hardExceeded, a.labels...),
+	}
+}
+
+// pathPrefix returns the first depth elements of path.
+func pathPrefix(path string, depth int) string {
+	elements := strings.Split(strings.Trim(path, "/"), "/")
+	if len(elements) > depth {
+		elements = elements[:depth]
+	}
+	return "/" + strings.Join(elements, "/")
+}
+
+// personaName returns the user or group name of a quota persona, falling
+// back to its id (UID, GID or SID) when the name can not be resolved.
+func personaName(persona gjson.Result) string {
+	if name := persona.Get("name").String(); name != "" {
+		return name
+	}
+	return persona.Get("id").String()
+}
+
+// zoneForPath returns the access zone whose base path is the longest prefix of path.
+func zoneForPath(path string, zones map[string]string) (zone string) {
+	longest := -1
+	for base, name := range zones {
+		if (path == base || strings.HasPrefix(path, strings.TrimSuffix(base, "/")+"/")) && len(base) > longest {
+			longest = len(base)
+			zone = name
+		}
+	}
+	return
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiQuotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pathHardQuota
+	ch <- pathSoftQuota
+	ch <- pathAdvisoryQuota
+	ch <- pathLogicalUsed
+	ch <- pathPhysicalUsed
+	ch <- quotaInodesUsed
+	ch <- quotaSoftGrace
+	ch <- quotaSoftExceeded
+	ch <- quotaHardExceeded
+	ch <- quotaAdvisoryExceeded
+	ch <- quotaSoftLastExceeded
+	ch <- quotaHardLastExceeded
+	ch <- quotaAdvisoryLastExceeded
+	ch <- quotaOver
+	ch <- quotaAggregateQuotas
+	ch <- quotaAggregateHardQuota
+	ch <- quotaAggregateLogicalUsed
+	ch <- quotaAggregatePhysicalUsed
+	ch <- quotaAggregateInodesUsed
+	ch <- quotaAggregateSoftExceeded
+	ch <- quotaAggregateHardExceeded
+	ch <- quotaScrapeSuccess
+	quotaSeriesDropped.Describe(ch)
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+// statisticsBatchSize is the number of keys requested per statistics/current call
+const statisticsBatchSize = 50
+
+var (
+	statisticsScrapeSuccess = newScrapeSuccessDesc("statistics")
+
+	// invalidMetricChars matches everything not allowed in a metric name
+	invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+// statisticMetric is a single statistics key resolved from the configuration
+type statisticMetric struct {
+	key  string
+	desc *prometheus.Desc
+	// withKey adds the key as label as several keys share the metric name
+	withKey   bool
+	perNode   bool
+	valueType prometheus.ValueType
+	scale     float64
+}
+
+// A IsiStatisticsCollector implements the prometheus.Collector.
+// It exports the OneFS statistics keys listed in the configuration file.
+type IsiStatisticsCollector struct {
+	isiClient  *isiclient.ISIClient
+	namespace  string
+	statistics []isiconfig.StatisticConfig
+}
+
+// NewIsiStatisticsCollector returns an initialized Isilon Statistics Collector.
+func NewIsiStatisticsCollector(emcisi *isiclient.ISIClient, namespace string, statistics []isiconfig.StatisticConfig) (*IsiStatisticsCollector, error) {
+
+	log.Debugln("Init statistics exporter")
+	return &IsiStatisticsCollector{
+		isiClient:  emcisi,
+		namespace:  namespace,
+		statistics: statistics,
+	}, nil
+}
+
+// Collect fetches the configured statistics keys from the Isilon cluster and
+// delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiStatisticsCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Statistics collect starting")
+	success := true
+
+	metrics, err := e.resolve()
+	if err != nil {
+		log.Infof("Unable to retrieve statistics keys from %s: %s", e.isiClient.ClusterName, err)
+		success = false
+	}
+
+	// Batch the keys up per devid scope, one call per batch
+	byDevid := map[string][]string{}
+	byKey := map[string][]statisticMetric{}
+	for devid, list := range metrics {
+		for _, m := range list {
+			if _, ok := byKey[devid+"/"+m.key]; !ok {
+				byDevid[devid] = append(byDevid[devid], m.key)
+			}
+			byKey[devid+"/"+m.key] = append(byKey[devid+"/"+m.key], m)
+		}
+	}
+	for devid, keys := range byDevid {
+		for len(keys) > 0 {
+			n := statisticsBatchSize
+			if len(keys) < n {
+				n = len(keys)
+			}
+			batch := keys[:n]
+			keys = keys[n:]
+
+			args := url.Values{"key": batch}
+			for _, d := range strings.Split(devid, ",") {
+				if d != "" {
+					args.Add("devid", d)
+				}
+			}
+			reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/statistics/current?" + args.Encode()
+			s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+			if err != nil || s == "" {
+				log.Infof("Unable to retrieve statistics from %s: %v", e.isiClient.ClusterName, err)
+				success = false
+				continue
+			}
+			gjson.Get(s, "stats").ForEach(func(_, value gjson.Result) bool {
+				key := value.Get("key").String()
+				v := value.Get("value")
+				if v.Type != gjson.Number {
+					log.Debugf("Skipping statistics key %s of %s, value is not a number", key, e.isiClient.ClusterName)
+					return true
+				}
+				for _, m := range byKey[devid+"/"+key] {
+					labels := []string{e.isiClient.ClusterName}
+					if m.perNode {
+						labels = append(labels, value.Get("devid").String())
+					}
+					if m.withKey {
+						labels = append(labels, key)
+					}
+					ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, v.Float()*m.scale, labels...)
+				}
+				return true
+			})
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(statisticsScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("Statistics exporter finished")
+}
+
+// resolve turns the configured statistics into metrics grouped by devid scope,
+// expanding globs against the keys known to the cluster.
+func (e *IsiStatisticsCollector) resolve() (map[string][]statisticMetric, error) {
+	var (
+		known []string
+		err   error
+	)
+	metrics := map[string][]statisticMetric{}
+	// owner is the entry each metric name is exported for, names derived from
+	// the key catalog can still collide with another entry
+	owner := map[string]int{}
+	for i, s := range e.statistics {
+		keys := []string{s.Key}
+		if s.IsGlob() {
+			if known == nil && err == nil {
+				known, err = clusterStatisticsKeys(e.isiClient)
+			}
+			keys = nil
+			for _, k := range known {
+				if ok, _ := path.Match(s.Key, k); ok {
+					keys = append(keys, k)
+				}
+			}
+		}
+
+		valueType := prometheus.GaugeValue
+		if s.Type == "counter" {
+			valueType = prometheus.CounterValue
+		}
+		perNode := s.Devid != "" && s.Devid != "0"
+		labels := []string{"clustername"}
+		if perNode {
+			labels = append(labels, "node")
+		}
+		withKey := s.IsGlob() && s.Name != ""
+		if withKey {
+			labels = append(labels, "key")
+		}
+
+		for _, k := range keys {
+			// The key catalog fills in whatever the configuration leaves out. Keys
+			// that can not be described are skipped rather than exported under a
+			// different name or scale.
+			info := StatisticsKey{Key: k}
+			if s.Name == "" || (s.Help == "" && !withKey) {
+				d, derr := describeStatisticsKey(e.isiClient, k)
+				if derr != nil {
+					log.Infof("Unable to describe statistics key %s of %s: %s", k, e.isiClient.ClusterName, derr)
+					err = derr
+					continue
+				}
+				info = d
+			}
+			name, scale, unit := s.Name, s.Scale, info.Units
+			if name == "" {
+				name = invalidMetricChars.ReplaceAllString(k, "_")
+				if suffix, unitScale, ok := info.BaseUnit(); ok {
+					if !strings.HasSuffix(name, "_"+suffix) && !strings.Contains(name, "_"+suffix+"_") {
+						name += "_" + suffix
+					}
+					if scale == 0 {
+						scale, unit = unitScale, strings.Replace(suffix, "_", " ", -1)
+					}
+				}
+			}
+			if o, ok := owner[name]; ok && (o != i || !withKey) {
+				log.Infof("Skipping statistics key %s of %s, metric %s is already exported", k, e.isiClient.ClusterName, name)
+				continue
+			}
+			owner[name] = i
+			if scale == 0 {
+				scale = 1
+			} else if s.Scale != 0 && s.Scale != 1 {
+				// The unit of the key no longer applies to scaled values
+				unit = ""
+			}
+			help := s.Help
+			if help == "" {
+				help = info.Help(unit)
+				if withKey {
+					help = "OneFS statistics keys matching " + s.Key + "."
+				}
+			}
+			metrics[s.Devid] = append(metrics[s.Devid], statisticMetric{
+				key:       k,
+				desc:      prometheus.NewDesc(prometheus.BuildFQName("emcisi", "", name), help, labels, nil),
+				withKey:   withKey,
+				perNode:   perNode,
+				valueType: valueType,
+				scale:     scale,
+			})
+		}
+	}
+	return metrics, err
+}
+
+// Describe describes the metrics exported from this collector. The statistics
+// metrics themselves depend on the keys known to the cluster and are not described.
+func (e *IsiStatisticsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- statisticsScrapeSuccess
+}
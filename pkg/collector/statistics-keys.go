@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// statisticsKeysTTL is how long the statistics key catalog of a cluster is cached
+	statisticsKeysTTL = time.Hour
+	// statisticsKeysRetry is how long to wait before fetching a catalog that failed again
+	statisticsKeysRetry = 5 * time.Minute
+)
+
+// StatisticsKey describes a OneFS statistics key as listed by /platform/1/statistics/keys
+type StatisticsKey struct {
+	Key         string
+	Description string
+	Units       string
+	// Type is the data type of the value, e.g. int64 or double
+	Type string
+	// Scope is cluster for cluster wide keys and node for keys reported per node
+	Scope string
+}
+
+// baseUnit maps the OneFS unit of a key to the suffix of a metric in Prometheus
+// base units and the factor converting a value into it.
+type baseUnit struct {
+	suffix string
+	scale  float64
+}
+
+// baseUnits lists the OneFS units that have a Prometheus base unit
+var baseUnits = map[string]baseUnit{
+	"b":       {"bytes", 1},
+	"bytes":   {"bytes", 1},
+	"b/s":     {"bytes_per_second", 1},
+	"bytes/s": {"bytes_per_second", 1},
+	"op/s":    {"ops_per_second", 1},
+	"ops/s":   {"ops_per_second", 1},
+	"s":       {"seconds", 1},
+	"sec":     {"seconds", 1},
+	"seconds": {"seconds", 1},
+	"ms":      {"seconds", 1e-3},
+	"msec":    {"seconds", 1e-3},
+	"us":      {"seconds", 1e-6},
+	"usec":    {"seconds", 1e-6},
+	"%":       {"percent", 1},
+	"percent": {"percent", 1},
+}
+
+// BaseUnit returns the Prometheus unit suffix of the key and the factor that
+// converts its values into that unit. ok is false for unknown units.
+func (k StatisticsKey) BaseUnit() (suffix string, scale float64, ok bool) {
+	u, ok := baseUnits[strings.ToLower(strings.TrimSpace(k.Units))]
+	return u.suffix, u.scale, ok
+}
+
+// Help returns a help text for a metric exporting the key with values in unit.
+// An empty unit is left out of the help text.
+func (k StatisticsKey) Help(unit string) string {
+	help := strings.TrimSpace(k.Description)
+	if help == "" {
+		help = "OneFS statistics key " + k.Key
+	}
+	help = strings.TrimSuffix(help, ".")
+	if unit != "" {
+		help += " (in " + unit + ")"
+	}
+	return help + "."
+}
+
+// keyCatalog holds the statistics keys of one cluster
+type keyCatalog struct {
+	keys    map[string]StatisticsKey
+	names   []string
+	fetched time.Time
+	// err is set when the catalog could not be fetched, single keys are still looked up
+	err error
+}
+
+// statisticsCatalogs caches the statistics key catalog of each cluster, keyed
+// by cluster name, as it rarely changes and is expensive to fetch.
+var statisticsCatalogs = struct {
+	sync.Mutex
+	byCluster map[string]*keyCatalog
+}{byCluster: map[string]*keyCatalog{}}
+
+// clusterStatisticsKeys returns the names of every statistics key of the cluster
+func clusterStatisticsKeys(c *isiclient.ISIClient) ([]string, error) {
+	statisticsCatalogs.Lock()
+	defer statisticsCatalogs.Unlock()
+	cat, err := catalog(c)
+	if err != nil {
+		return nil, err
+	}
+	return cat.names, nil
+}
+
+// catalogStatisticsKey returns the catalog entry of a key, without looking up
+// keys missing from the catalog one by one.
+func catalogStatisticsKey(c *isiclient.ISIClient, key string) (StatisticsKey, bool) {
+	statisticsCatalogs.Lock()
+	defer statisticsCatalogs.Unlock()
+	cat, err := catalog(c)
+	if err != nil {
+		log.Debugf("Unable to retrieve statistics key catalog from %s: %s", c.ClusterName, err)
+	}
+	k, ok := cat.keys[key]
+	return k, ok
+}
+
+// describeStatisticsKey returns the catalog entry of a key. Keys missing from the
+// catalog are looked up one by one and cached as well.
+func describeStatisticsKey(c *isiclient.ISIClient, key string) (StatisticsKey, error) {
+	statisticsCatalogs.Lock()
+	defer statisticsCatalogs.Unlock()
+	cat, err := catalog(c)
+	if err != nil {
+		log.Debugf("Unable to retrieve statistics key catalog from %s: %s", c.ClusterName, err)
+	}
+	if k, ok := cat.keys[key]; ok {
+		return k, nil
+	}
+
+	reqStatusURL := "https://" + c.ClusterAddress + ":8080/platform/1/statistics/keys/" + url.PathEscape(key)
+	s, err := c.CallIsiAPI(reqStatusURL, 1)
+	if err != nil {
+		return StatisticsKey{}, err
+	}
+	if s == "" {
+		return StatisticsKey{}, fmt.Errorf("no description of statistics key %s", key)
+	}
+	k := parseStatisticsKey(gjson.Get(s, "keys.0"))
+	k.Key = key
+	cat.keys[key] = k
+	return k, nil
+}
+
+// catalog returns the cached catalog of the cluster, fetching it when missing
+// or expired. On error the returned catalog only holds the keys looked up one
+// by one. The caller must hold the statisticsCatalogs lock.
+func catalog(c *isiclient.ISIClient) (*keyCatalog, error) {
+	if cat, ok := statisticsCatalogs.byCluster[c.ClusterName]; ok {
+		if (cat.err == nil && time.Since(cat.fetched) < statisticsKeysTTL) || (cat.err != nil && time.Since(cat.fetched) < statisticsKeysRetry) {
+			return cat, cat.err
+		}
+	}
+
+	cat := &keyCatalog{keys: map[string]StatisticsKey{}, fetched: time.Now()}
+	statisticsCatalogs.byCluster[c.ClusterName] = cat
+	reqStatusURL := "https://" + c.ClusterAddress + ":8080/platform/1/statistics/keys"
+	pages, err := c.CallIsiAPIPages(reqStatusURL, 1)
+	if err != nil {
+		cat.err = err
+		return cat, err
+	}
+	for _, page := range pages {
+		gjson.Get(page, "keys").ForEach(func(_, value gjson.Result) bool {
+			k := parseStatisticsKey(value)
+			cat.keys[k.Key] = k
+			cat.names = append(cat.names, k.Key)
+			return true
+		})
+	}
+	return cat, nil
+}
+
+// parseStatisticsKey reads a key description returned by the cluster
+func parseStatisticsKey(r gjson.Result) StatisticsKey {
+	return StatisticsKey{
+		Key:         r.Get("key").String(),
+		Description: r.Get("description").String(),
+		Units:       r.Get("units").String(),
+		Type:        r.Get("type").String(),
+		Scope:       strings.ToLower(r.Get("scope").String()),
+	}
+}
+
+// statisticDesc describes a metric exporting a statistics key as is. Its help
+// text is the description and unit of the key in the catalog of the cluster,
+// the fallback help is used when the catalog does not describe the key.
+type statisticDesc struct {
+	key    string
+	name   string
+	labels []string
+	// fallback is described to the registry and used without a catalog entry
+	fallback *prometheus.Desc
+}
+
+// newStatisticDesc returns the description of a metric exporting key
+func newStatisticDesc(key, name, help string, labels ...string) *statisticDesc {
+	return &statisticDesc{key: key, name: name, labels: labels, fallback: prometheus.NewDesc(name, help, labels, nil)}
+}
+
+// desc returns the desc of the metric for a cluster
+func (d *statisticDesc) desc(c *isiclient.ISIClient) *prometheus.Desc {
+	k, ok := catalogStatisticsKey(c, d.key)
+	if !ok || strings.TrimSpace(k.Description) == "" {
+		return d.fallback
+	}
+	unit := ""
+	if suffix, _, ok := k.BaseUnit(); ok {
+		unit = strings.Replace(suffix, "_", " ", -1)
+	}
+	return prometheus.NewDesc(d.name, k.Help(unit), d.labels, nil)
+}
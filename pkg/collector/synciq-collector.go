@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	synciqPolicyEnabled = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "synciq", "policy_enabled"),
+		"Indicates if the SyncIQ policy is enabled (1) or not (0).",
+		[]string{"clustername", "policy"}, nil,
+	)
+	synciqPolicyLastJobState = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "synciq", "policy_last_job_state"),
+		"A metric with a constant '1' value labeled by the state of the last job of each SyncIQ policy.",
+		[]string{"clustername", "policy", "state"}, nil,
+	)
+	synciqPolicyLastSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "synciq", "policy_last_success_timestamp_seconds"),
+		"Unix time the last successful job of the SyncIQ policy started. Not reported for policies that never succeeded.",
+		[]string{"clustername", "policy"}, nil,
+	)
+	synciqPolicies = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "synciq", "policies"),
+		"Number of SyncIQ policies configured on the cluster.",
+		[]string{"clustername"}, nil,
+	)
+	synciqScrapeSuccess = newScrapeSuccessDesc("synciq")
+)
+
+// A IsiSyncIQCollector implements the prometheus.Collector.
+// It reports the state and last success of the SyncIQ replication policies.
+type IsiSyncIQCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+}
+
+// NewIsiSyncIQCollector returns an initialized Isilon SyncIQ Collector.
+func NewIsiSyncIQCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiSyncIQCollector, error) {
+
+	log.Debugln("Init SyncIQ exporter")
+	return &IsiSyncIQCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+	}, nil
+}
+
+// Collect fetches the SyncIQ policies from the Isilon cluster and delivers
+// them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiSyncIQCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon SyncIQ collect starting")
+	success := true
+
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/1/sync/policies"
+	pages, err := e.isiClient.CallIsiAPIPages(reqStatusURL, 1)
+	if err != nil {
+		log.Infof("Unable to retrieve SyncIQ policies from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		var count float64
+		for _, page := range pages {
+			gjson.Get(page, "policies").ForEach(func(key, value gjson.Result) bool {
+				policy := value.Get("name").String()
+				if policy == "" {
+					policy = value.Get("id").String()
+				}
+				ch <- prometheus.MustNewConstMetric(synciqPolicyEnabled, prometheus.GaugeValue, boolToFloat(value.Get("enabled").Bool()), e.isiClient.ClusterName, policy)
+				if state := strings.ToLower(value.Get("last_job_state").String()); state != "" {
+					ch <- prometheus.MustNewConstMetric(synciqPolicyLastJobState, prometheus.GaugeValue, 1, e.isiClient.ClusterName, policy, state)
+				}
+				if last := value.Get("last_success"); last.Int() > 0 {
+					ch <- prometheus.MustNewConstMetric(synciqPolicyLastSuccess, prometheus.GaugeValue, last.Float(), e.isiClient.ClusterName, policy)
+				}
+				count++
+				return true
+			})
+		}
+		ch <- prometheus.MustNewConstMetric(synciqPolicies, prometheus.GaugeValue, count, e.isiClient.ClusterName)
+	}
+
+	ch <- prometheus.MustNewConstMetric(synciqScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("SyncIQ exporter finished")
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiSyncIQCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- synciqPolicyEnabled
+	ch <- synciqPolicyLastJobState
+	ch <- synciqPolicyLastSuccess
+	ch <- synciqPolicies
+	ch <- synciqScrapeSuccess
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	upgradeClusterState = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "cluster_state"),
+		"A metric with a constant '1' value labeled by the upgrade state of the cluster.",
+		[]string{"clustername", "state"}, nil,
+	)
+	upgradeCommitted = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "committed"),
+		"Indicates if the last upgrade of the cluster has been committed (1) or not (0).",
+		[]string{"clustername"}, nil,
+	)
+	upgradeInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "info"),
+		"A metric with a constant '1' value labeled by the current and target OneFS version of the cluster.",
+		[]string{"clustername", "current_version", "target_version"}, nil,
+	)
+	upgradeStartTime = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "start_timestamp_seconds"),
+		"Unix time the current or last upgrade was started.",
+		[]string{"clustername"}, nil,
+	)
+	upgradeNodeState = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "node_state"),
+		"A metric with a constant '1' value labeled by the upgrade state of each node.",
+		[]string{"clustername", "node", "state"}, nil,
+	)
+	upgradeNodeProgress = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "node_progress"),
+		"The upgrade progress of each node in percent.",
+		[]string{"clustername", "node"}, nil,
+	)
+	upgradeNodeInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "node_info"),
+		"A metric with a constant '1' value labeled by the current and target OneFS version of each node.",
+		[]string{"clustername", "node", "version", "target_version"}, nil,
+	)
+	upgradePatchInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "upgrade", "patch_info"),
+		"A metric with a constant '1' value labeled by each patch known to the cluster and its status.",
+		[]string{"clustername", "patch", "status"}, nil,
+	)
+	upgradeScrapeSuccess = newScrapeSuccessDesc("upgrade")
+)
+
+// A IsiUpgradeCollector implements the prometheus.Collector.
+// It reports the OneFS upgrade state of the cluster and its nodes and the installed patches.
+type IsiUpgradeCollector struct {
+	isiClient *isiclient.ISIClient
+	namespace string
+}
+
+// NewIsiUpgradeCollector returns an initialized Isilon Upgrade Collector.
+func NewIsiUpgradeCollector(emcisi *isiclient.ISIClient, namespace string) (*IsiUpgradeCollector, error) {
+
+	log.Debugln("Init upgrade exporter")
+	return &IsiUpgradeCollector{
+		isiClient: emcisi,
+		namespace: namespace,
+	}, nil
+}
+
+// Collect fetches the upgrade and patch status from the Isilon cluster and
+// delivers them as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *IsiUpgradeCollector) Collect(ch chan<- prometheus.Metric) {
+	log.Debugln("Isilon Upgrade collect starting")
+	success := true
+	targetVersion := ""
+
+	// Cluster wide upgrade state
+	reqStatusURL := "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/upgrade/cluster"
+	s, err := e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve upgrade status from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		state := strings.ToLower(gjson.Get(s, "cluster_state").String())
+		targetVersion = versionString(gjson.Get(s, "onefs_version_upgrade"))
+		currentVersion := versionString(gjson.Get(s, "onefs_version_current"))
+		if currentVersion == "" {
+			currentVersion = e.isiClient.ISIVersion
+		}
+		ch <- prometheus.MustNewConstMetric(upgradeClusterState, prometheus.GaugeValue, 1, e.isiClient.ClusterName, state)
+		ch <- prometheus.MustNewConstMetric(upgradeCommitted, prometheus.GaugeValue, boolToFloat(state == "committed"), e.isiClient.ClusterName)
+		ch <- prometheus.MustNewConstMetric(upgradeInfo, prometheus.GaugeValue, 1, e.isiClient.ClusterName, currentVersion, targetVersion)
+		if start := gjson.Get(s, "upgrade_start_time"); start.Exists() && start.Int() > 0 {
+			ch <- prometheus.MustNewConstMetric(upgradeStartTime, prometheus.GaugeValue, start.Float(), e.isiClient.ClusterName)
+		}
+	}
+
+	// Per node progress
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/upgrade/cluster/nodes"
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve node upgrade status from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		result := gjson.Get(s, "nodes")
+		result.ForEach(func(key, value gjson.Result) bool {
+			node := value.Get("lnn").String()
+			nodeTarget := versionString(value.Get("onefs_version.upgrade"))
+			if nodeTarget == "" {
+				nodeTarget = targetVersion
+			}
+			ch <- prometheus.MustNewConstMetric(upgradeNodeState, prometheus.GaugeValue, 1, e.isiClient.ClusterName, node, strings.ToLower(value.Get("node_state").String()))
+			ch <- prometheus.MustNewConstMetric(upgradeNodeProgress, prometheus.GaugeValue, value.Get("progress").Float(), e.isiClient.ClusterName, node)
+			ch <- prometheus.MustNewConstMetric(upgradeNodeInfo, prometheus.GaugeValue, 1, e.isiClient.ClusterName, node, versionString(value.Get("onefs_version")), nodeTarget)
+			return true
+		})
+	}
+
+	// Installed patches
+	reqStatusURL = "https://" + e.isiClient.ClusterAddress + ":8080/platform/3/upgrade/patch/patches"
+	s, err = e.isiClient.CallIsiAPI(reqStatusURL, 1)
+	if err != nil || s == "" {
+		log.Infof("Unable to retrieve patches from %s: %v", e.isiClient.ClusterName, err)
+		success = false
+	} else {
+		result := gjson.Get(s, "patches")
+		result.ForEach(func(key, value gjson.Result) bool {
+			patch := value.Get("name").String()
+			if patch == "" {
+				patch = value.Get("id").String()
+			}
+			ch <- prometheus.MustNewConstMetric(upgradePatchInfo, prometheus.GaugeValue, 1, e.isiClient.ClusterName, patch, strings.ToLower(value.Get("status").String()))
+			return true
+		})
+	}
+
+	ch <- prometheus.MustNewConstMetric(upgradeScrapeSuccess, prometheus.GaugeValue, boolToFloat(success), e.isiClient.ClusterName)
+	log.Debugln("Upgrade exporter finished")
+}
+
+// versionString returns the release of a OneFS version object, which the API
+// reports either as a plain string or as an object with release and build.
+func versionString(r gjson.Result) string {
+	if r.IsObject() {
+		if v := r.Get("release").String(); v != "" {
+			return v
+		}
+		return r.Get("version").String()
+	}
+	return r.String()
+}
+
+// Describe describes the metrics exported from this collector.
+func (e *IsiUpgradeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upgradeClusterState
+	ch <- upgradeCommitted
+	ch <- upgradeInfo
+	ch <- upgradeStartTime
+	ch <- upgradeNodeState
+	ch <- upgradeNodeProgress
+	ch <- upgradeNodeInfo
+	ch <- upgradePatchInfo
+	ch <- upgradeScrapeSuccess
+}
@@ -2,61 +2,124 @@ package isiconfig
 
 import (
 	"flag"
-
-	"github.com/jamiealquiza/envy"
+	"time"
 )
 
 type isiConfig struct {
-	UserName string
-	Password string
-	MgmtPort int
-	IsiURL   string
+	// Credentials are used to log in to the clusters
+	Credentials *Credentials
+	MgmtPort    int
+	IsiURL      string
 }
 
 type exporterConfig struct {
 	BindAddress string
 	BindPort    int
-	LogLevel    string
-	MultiQuery  bool
+	// ReadTimeout and WriteTimeout bound reading a request and writing its
+	// response, WriteTimeout thus also bounds the duration of a scrape
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests and collections are
+	// waited for on shutdown
+	ShutdownTimeout time.Duration
+	LogLevel        string
+	MultiQuery      bool
+	// RateGauges also exports the averaged throughput gauges replaced by counters
+	RateGauges bool
+	// WebConfigFile is the web configuration file with the TLS and basic
+	// authentication settings of the HTTP endpoints
+	WebConfigFile string
+}
+
+type alertsConfig struct {
+	AlertmanagerURL string
+	Interval        time.Duration
+	StateFile       string
 }
 
 // Config is a container for settings modifiable by the user
 type Config struct {
 	ISI      isiConfig
 	Exporter exporterConfig
+	Alerts   alertsConfig
+	// Quota holds the default quota settings for clusters without their own
+	Quota QuotaConfig
+	// Event holds the default event settings for clusters without their own
+	Event EventConfig
+	// Statistics holds the default statistics keys for clusters without their own
+	Statistics []StatisticConfig
+	// Polling holds the default background polling settings for clusters without their own
+	Polling PollingConfig
+	// Collectors holds the default optional collectors for clusters without their own
+	Collectors CollectorsConfig
+	// Push holds the settings of pushing the metrics of every cluster
+	Push PushConfig
+	// OTLP holds the settings of exporting every cluster over OTLP, nil when disabled
+	OTLP *OTLPConfig
+	// AllowedTargets lists the targets the query endpoints accept besides the configured clusters
+	AllowedTargets AllowedTargetsConfig
+	// ServiceDiscovery holds the defaults of the targets listed on /sd
+	ServiceDiscovery ServiceDiscoveryConfig
+	// Clusters holds the per cluster settings read from the configuration file
+	Clusters []ClusterConfig
 }
 
 var (
-	isiMgmtPort   = flag.Int("mgmtport", 8080, "The port which isilon listens to for administration")
-	isiUserName   = flag.String("username", "defaultUser", "Username")
-	isiPassword   = flag.String("password", "defaultPass", "Password")
-	listenAddress = flag.String("bindaddress", "localhost", "Exporter bind address")
-	listenPort    = flag.Int("bindport", 9437, "Exporter bind port")
-	isiURL        = flag.String("url", "", "Base URL of the Isilon management interface.  Normally something like https://my-isilon.something.x")
-	multiQuery    = flag.Bool("multi", false, "Enable query endpoint")
+	isiMgmtPort     = flag.Int("mgmtport", 8080, "The port which isilon listens to for administration")
+	isiUserName     = flag.String("username", "", "Username")
+	isiPassword     = flag.String("password", "", "Password")
+	passwordFile    = flag.String("passwordfile", "", "Path to a file holding the password, read again when it changes")
+	listenAddress   = flag.String("bindaddress", "", "Exporter bind address, all interfaces when empty")
+	listenPort      = flag.Int("bindport", 9437, "Exporter bind port")
+	readTimeout     = flag.Duration("readtimeout", 30*time.Second, "Maximum duration for reading a request")
+	writeTimeout    = flag.Duration("writetimeout", 5*time.Minute, "Maximum duration for writing a response, including the scrape")
+	shutdownTimeout = flag.Duration("shutdowntimeout", 30*time.Second, "How long in-flight scrapes are waited for on shutdown")
+	isiURL          = flag.String("url", "", "Base URL of the Isilon management interface.  Normally something like https://my-isilon.something.x")
+	multiQuery      = flag.Bool("multi", false, "Enable query endpoint")
+	configFile      = flag.String("config", "", "Path to a YAML file with per cluster settings")
+	alertmanager    = flag.String("alertmanager", "", "URL of an Alertmanager to forward OneFS events to, e.g. http://localhost:9093")
+	alertInterval   = flag.Duration("alertinterval", time.Minute, "How often OneFS events are forwarded to the Alertmanager")
+	alertState      = flag.String("alertstate", "isilon-alerts.json", "File keeping track of the alerts sent to the Alertmanager")
+	rateGauges      = flag.Bool("rategauges", false, "Also export the throughput gauges replaced by _total counters")
+	webConfig       = flag.String("webconfig", "", "Path to a web configuration file enabling TLS and basic authentication")
 )
 
-func init() {
-
-	envy.Parse("ISIENV") // looks for ISIENV_USERNAME, ISIENV_PASSWORD, ISIENV_BINDPORT etc
-	flag.Parse()
-
-}
-
 // GetConfig returns an instance of Config containing the resulting parameters
 // to the program
-func GetConfig() *Config {
-	return &Config{
+func GetConfig() (*Config, error) {
+	cfg := &Config{
 		ISI: isiConfig{
-			UserName: *isiUserName,
-			Password: *isiPassword,
+			Credentials: &Credentials{
+				UserName:     *isiUserName,
+				Password:     *isiPassword,
+				PasswordFile: *passwordFile,
+			},
 			MgmtPort: *isiMgmtPort,
 			IsiURL:   *isiURL,
 		},
 		Exporter: exporterConfig{
-			BindAddress: *listenAddress,
-			BindPort:    *listenPort,
-			MultiQuery:  *multiQuery,
+			BindAddress:     *listenAddress,
+			BindPort:        *listenPort,
+			ReadTimeout:     *readTimeout,
+			WriteTimeout:    *writeTimeout,
+			ShutdownTimeout: *shutdownTimeout,
+			MultiQuery:      *multiQuery,
+			RateGauges:      *rateGauges,
+			WebConfigFile:   *webConfig,
+		},
+		Alerts: alertsConfig{
+			AlertmanagerURL: *alertmanager,
+			Interval:        *alertInterval,
+			StateFile:       *alertState,
 		},
 	}
+	if *configFile != "" {
+		if err := loadFile(*configFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ISI.Credentials.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
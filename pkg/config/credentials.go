@@ -0,0 +1,189 @@
+package isiconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The credentials of the flags before they had to be set. The exporter refuses
+// to start with them.
+const (
+	defaultUserName = "defaultUser"
+	defaultPassword = "defaultPass"
+)
+
+// SecretProvider reads secrets from a secret store
+type SecretProvider interface {
+	// Secret returns the value stored under key
+	Secret(key string) (string, error)
+}
+
+// Credentials holds the user name and password the exporter logs in to the
+// clusters with. The password is either given as is, read from a file or read
+// from a secret provider, and asked for again on every request so it can be
+// rotated without a restart.
+type Credentials struct {
+	// UserName is the user name, unless UserNameKey reads it from the provider
+	UserName string `yaml:"username"`
+	// Password is the password as is
+	Password string `yaml:"password"`
+	// PasswordFile is a file holding the password, read again when it changes
+	PasswordFile string `yaml:"password_file"`
+	// Vault reads the credentials from a HashiCorp Vault KV secret
+	Vault *VaultConfig `yaml:"vault"`
+	// UserNameKey is the key of the user name in the secret provider, if it holds it
+	UserNameKey string `yaml:"username_key"`
+	// PasswordKey is the key of the password in the secret provider, password when not set
+	PasswordKey string `yaml:"password_key"`
+
+	// Provider is the secret store of the credentials, if any
+	Provider SecretProvider `yaml:"-"`
+
+	mtx      sync.Mutex
+	filePass string
+	modified time.Time
+	size     int64
+}
+
+// Get returns the current user name and password. It implements
+// isiclient.Credentials.
+func (c *Credentials) Get() (user, pass string, err error) {
+	user = c.UserName
+	switch {
+	case c.Provider != nil:
+		if c.UserNameKey != "" {
+			if user, err = c.Provider.Secret(c.UserNameKey); err != nil {
+				return "", "", err
+			}
+		}
+		key := c.PasswordKey
+		if key == "" {
+			key = "password"
+		}
+		if pass, err = c.Provider.Secret(key); err != nil {
+			return "", "", err
+		}
+		// The secret is only read at request time, so its values are
+		// checked here rather than when the configuration is loaded
+		if err = checkCredentials(user, pass); err != nil {
+			return "", "", err
+		}
+	case c.PasswordFile != "":
+		pass, err = c.readPasswordFile()
+	default:
+		pass = c.Password
+	}
+	return user, pass, err
+}
+
+// readPasswordFile returns the password in the password file, reading it again
+// when its size or modification time changed
+func (c *Credentials) readPasswordFile() (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	fi, err := os.Stat(c.PasswordFile)
+	if err != nil {
+		return "", err
+	}
+	if !c.modified.IsZero() && fi.ModTime().Equal(c.modified) && fi.Size() == c.size {
+		return c.filePass, nil
+	}
+	content, err := ioutil.ReadFile(c.PasswordFile)
+	if err != nil {
+		return "", err
+	}
+	c.filePass = strings.TrimRight(string(content), "\r\n")
+	c.modified, c.size = fi.ModTime(), fi.Size()
+	return c.filePass, nil
+}
+
+// validate checks the credentials are complete and are not the old defaults.
+// Credentials in a secret provider are only checked for their settings, the
+// secret is read on the first request so the exporter starts and reloads while
+// the secret store is unavailable.
+func (c *Credentials) validate() error {
+	sources := 0
+	for _, set := range []bool{c.Password != "", c.PasswordFile != "", c.Provider != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("credentials can use only one of password, password_file and a secret provider")
+	}
+	if c.Provider == nil && c.UserNameKey != "" {
+		return fmt.Errorf("credentials username_key needs a secret provider")
+	}
+	if c.Provider != nil {
+		if c.UserName == "" && c.UserNameKey == "" {
+			return fmt.Errorf("no Isilon username given")
+		}
+		if c.UserNameKey == "" && c.UserName == defaultUserName {
+			return fmt.Errorf("refusing to run with the default Isilon username %s", defaultUserName)
+		}
+		return nil
+	}
+	user, pass, err := c.Get()
+	if err != nil {
+		return fmt.Errorf("reading credentials: %s", err)
+	}
+	return checkCredentials(user, pass)
+}
+
+// checkCredentials checks a user name and password are set and are not the old defaults
+func checkCredentials(user, pass string) error {
+	if user == "" || pass == "" {
+		return fmt.Errorf("no Isilon username and password given")
+	}
+	if user == defaultUserName || pass == defaultPassword {
+		return fmt.Errorf("refusing to run with the default Isilon credentials %s/%s", defaultUserName, defaultPassword)
+	}
+	return nil
+}
+
+// merge overrides the credentials of the flags with those of the configuration file
+func (c *Credentials) merge(file *Credentials) {
+	if file.UserName != "" {
+		c.UserName = file.UserName
+	}
+	if file.Password != "" || file.PasswordFile != "" || file.Vault != nil {
+		c.Password, c.PasswordFile, c.Vault = file.Password, file.PasswordFile, file.Vault
+	}
+	if file.Vault != nil {
+		c.Provider = NewVaultKV(*file.Vault)
+	}
+	c.UserNameKey, c.PasswordKey = file.UserNameKey, file.PasswordKey
+}
+
+// envReference matches ${NAME} references to environment variables
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in each field with the value of
+// the environment variable, failing on unset variables. $$ is replaced by a
+// single $.
+func expandEnv(fields ...*string) error {
+	var missing []string
+	for _, f := range fields {
+		parts := strings.Split(*f, "$$")
+		for i, part := range parts {
+			parts[i] = envReference.ReplaceAllStringFunc(part, func(ref string) string {
+				name := envReference.FindStringSubmatch(ref)[1]
+				value, ok := os.LookupEnv(name)
+				if !ok {
+					missing = append(missing, name)
+				}
+				return value
+			})
+		}
+		*f = strings.Join(parts, "$")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
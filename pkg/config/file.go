@@ -0,0 +1,764 @@
+package isiconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fileConfig is the layout of the YAML configuration file
+type fileConfig struct {
+	Quota      QuotaConfig       `yaml:"quota"`
+	Event      EventConfig       `yaml:"event"`
+	Statistics []StatisticConfig `yaml:"statistics"`
+	Polling    PollingConfig     `yaml:"polling"`
+	Collectors CollectorsConfig  `yaml:"collectors"`
+	Push       PushConfig        `yaml:"push"`
+	OTLP       *OTLPConfig       `yaml:"otlp"`
+	// AllowedTargets lists the targets the query endpoints accept besides the
+	// configured clusters
+	AllowedTargets AllowedTargetsConfig `yaml:"allowed_targets"`
+	// ServiceDiscovery holds the defaults of the targets listed on /sd
+	ServiceDiscovery ServiceDiscoveryConfig `yaml:"service_discovery"`
+	// Credentials override the credentials given with flags
+	Credentials *Credentials    `yaml:"credentials"`
+	Clusters    []ClusterConfig `yaml:"clusters"`
+}
+
+// ClusterConfig holds the settings for a single Isilon cluster
+type ClusterConfig struct {
+	// Name is the cluster name as reported by OneFS
+	Name string `yaml:"name"`
+	// Address is the hostname or IP the exporter connects to
+	Address string `yaml:"address"`
+	// Quota overrides the default quota collection settings for this cluster
+	Quota *QuotaConfig `yaml:"quota"`
+	// Event overrides the default event collection settings for this cluster
+	Event *EventConfig `yaml:"event"`
+	// Statistics replaces the default list of statistics keys for this cluster
+	Statistics []StatisticConfig `yaml:"statistics"`
+	// Polling overrides the default background polling settings for this cluster
+	Polling *PollingConfig `yaml:"polling"`
+	// Collectors overrides the default optional collectors for this cluster
+	Collectors *CollectorsConfig `yaml:"collectors"`
+	// Site and Environment label the cluster's target on /sd
+	Site        string `yaml:"site"`
+	Environment string `yaml:"environment"`
+	// Module overrides the default module parameter of the cluster's target on /sd
+	Module string `yaml:"module"`
+	// Labels are added to the labels of the cluster's target on /sd
+	Labels map[string]string `yaml:"labels"`
+}
+
+// ServiceDiscoveryConfig holds the defaults of the targets listed for
+// Prometheus HTTP service discovery
+type ServiceDiscoveryConfig struct {
+	// Module is set as the module parameter of every target, if not empty
+	Module string `yaml:"module"`
+	// Labels are added to every target, the labels of a cluster override them
+	Labels map[string]string `yaml:"labels"`
+}
+
+// labelName matches the label names Prometheus accepts
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateLabels refuses label names Prometheus does not accept or reserves
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// QuotaConfig controls which quotas are exported and how many series they may produce
+type QuotaConfig struct {
+	// IncludePaths only exports quotas whose path matches one of these regexes
+	IncludePaths []Regexp `yaml:"include_paths"`
+	// ExcludePaths drops quotas whose path matches one of these regexes
+	ExcludePaths []Regexp `yaml:"exclude_paths"`
+	// IncludePersonas only exports quotas whose persona matches one of these regexes
+	IncludePersonas []Regexp `yaml:"include_personas"`
+	// ExcludePersonas drops quotas whose persona matches one of these regexes
+	ExcludePersonas []Regexp `yaml:"exclude_personas"`
+	// Types only exports quotas of these types (directory, user, group, default-user, default-group)
+	Types []string `yaml:"types"`
+	// MaxSeries caps the number of quota series exported per scrape, 0 means no limit
+	MaxSeries int `yaml:"max_series"`
+	// AggregateDepth sums quotas up per path prefix of this many path elements
+	// (3 turns /ifs/projects/foo/bar into /ifs/projects/foo), 0 disables aggregation
+	AggregateDepth int `yaml:"aggregate_depth"`
+}
+
+// EventConfig controls the detail exported about unresolved event groups
+type EventConfig struct {
+	// ActiveInfo exports an info series for each unresolved event group
+	ActiveInfo bool `yaml:"active_info"`
+	// MaxActiveInfo caps the number of info series, the most severe and most recent
+	// event groups are kept. 0 means the default of 100.
+	MaxActiveInfo int `yaml:"max_active_info"`
+}
+
+// CollectorsConfig enables the optional collectors, which each add API calls
+// to every collection
+type CollectorsConfig struct {
+	// SyncIQ enables the SyncIQ collector reading /platform/1/sync/policies
+	SyncIQ bool `yaml:"synciq"`
+	// Drives enables the drive collector reading /platform/3/cluster/nodes
+	Drives bool `yaml:"drives"`
+}
+
+// defaultPollInterval is the time between two polls of a collector when no interval is set
+const defaultPollInterval = time.Minute
+
+// CollectorNames lists the collectors of a cluster, as used for the polling intervals
+var CollectorNames = []string{"cluster", "health", "upgrade", "dedupe", "quota", "event", "synciq", "drive", "statistics"}
+
+// PollingConfig controls the background polling of a cluster
+type PollingConfig struct {
+	// Enabled polls the cluster in the background and serves the latest results
+	// instead of querying the cluster on every scrape
+	Enabled bool `yaml:"enabled"`
+	// Interval is the time between two polls of each collector, 1m when not set
+	Interval time.Duration `yaml:"interval"`
+	// Intervals overrides the interval of single collectors, keyed by collector name
+	Intervals map[string]time.Duration `yaml:"intervals"`
+}
+
+// IntervalOf returns the polling interval of the named collector
+func (p PollingConfig) IntervalOf(name string) time.Duration {
+	if d, ok := p.Intervals[name]; ok && d > 0 {
+		return d
+	}
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return defaultPollInterval
+}
+
+// validate checks the polling intervals
+func (p PollingConfig) validate() error {
+	if p.Interval < 0 {
+		return fmt.Errorf("polling interval can not be negative")
+	}
+	for name, d := range p.Intervals {
+		found := false
+		for _, n := range CollectorNames {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("polling interval of unknown collector %q, must be one of %s", name, strings.Join(CollectorNames, ", "))
+		}
+		if d < 0 {
+			return fmt.Errorf("polling interval of %s can not be negative", name)
+		}
+	}
+	return nil
+}
+
+// defaultPushInterval and defaultPushJob are used when the push settings leave them out
+const (
+	defaultPushInterval = time.Minute
+	defaultPushJob      = "isilon"
+)
+
+// PushConfig controls pushing the metrics of the clusters to a Pushgateway, a
+// Prometheus remote_write endpoint or an InfluxDB, for clusters Prometheus can
+// not reach
+type PushConfig struct {
+	// Interval is the time between two pushes, 1m when not set
+	Interval time.Duration `yaml:"interval"`
+	// Job is the job the metrics are pushed as, isilon when not set
+	Job string `yaml:"job"`
+	// Pushgateway pushes the metrics of each cluster to its own group of a Pushgateway
+	Pushgateway *PushEndpoint `yaml:"pushgateway"`
+	// RemoteWrite sends the metrics to a Prometheus remote_write endpoint
+	RemoteWrite *PushEndpoint `yaml:"remote_write"`
+	// InfluxDB writes the metrics as line protocol to an InfluxDB v2 write API
+	InfluxDB *InfluxDBEndpoint `yaml:"influxdb"`
+}
+
+// PushEndpoint is an HTTP endpoint metrics are pushed to
+type PushEndpoint struct {
+	// URL is the base URL of a Pushgateway or the full URL of a remote_write endpoint
+	URL string `yaml:"url"`
+	// BasicAuth authenticates with a username and password
+	BasicAuth *BasicAuth `yaml:"basic_auth"`
+	// BearerToken authenticates with a bearer token
+	BearerToken string `yaml:"bearer_token"`
+	// Timeout of a single push, 30s when not set
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// InfluxDBEndpoint is the write API of an InfluxDB v2
+type InfluxDBEndpoint struct {
+	// PushEndpoint holds the base URL of the InfluxDB, e.g. http://influxdb:8086
+	PushEndpoint `yaml:",inline"`
+	// Org and Bucket the metrics are written to
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	// Token is the API token, sent as Authorization: Token
+	Token string `yaml:"token"`
+}
+
+// BasicAuth holds the credentials of HTTP basic authentication
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Enabled reports if the metrics are pushed anywhere
+func (p PushConfig) Enabled() bool {
+	return p.Pushgateway != nil || p.RemoteWrite != nil || p.InfluxDB != nil
+}
+
+// validate checks the push settings and fills in their defaults
+func (p *PushConfig) validate() error {
+	if p.Interval < 0 {
+		return fmt.Errorf("push interval can not be negative")
+	}
+	if p.Interval == 0 {
+		p.Interval = defaultPushInterval
+	}
+	if p.Job == "" {
+		p.Job = defaultPushJob
+	}
+	endpoints := map[string]*PushEndpoint{"pushgateway": p.Pushgateway, "remote_write": p.RemoteWrite}
+	if p.InfluxDB != nil {
+		if p.InfluxDB.Bucket == "" {
+			return fmt.Errorf("push influxdb needs a bucket")
+		}
+		if p.InfluxDB.Token != "" && (p.InfluxDB.BasicAuth != nil || p.InfluxDB.BearerToken != "") {
+			return fmt.Errorf("push influxdb can use only one of token, basic_auth and bearer_token")
+		}
+		endpoints["influxdb"] = &p.InfluxDB.PushEndpoint
+	}
+	for name, e := range endpoints {
+		if e == nil {
+			continue
+		}
+		if e.URL == "" {
+			return fmt.Errorf("push %s needs a url", name)
+		}
+		if e.BasicAuth != nil && e.BearerToken != "" {
+			return fmt.Errorf("push %s can use either basic_auth or bearer_token, not both", name)
+		}
+		if e.Timeout < 0 {
+			return fmt.Errorf("push %s timeout can not be negative", name)
+		}
+	}
+	return nil
+}
+
+// OTLP protocols
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+// OTLPConfig controls exporting the metrics of the clusters to an OpenTelemetry
+// collector over OTLP
+type OTLPConfig struct {
+	// Endpoint is the URL of the collector, e.g. http://otel-collector:4318 for
+	// http/protobuf or https://otel-collector:4317 for grpc. An http/protobuf
+	// endpoint without a path gets /v1/metrics appended.
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is either http/protobuf (the default) or grpc
+	Protocol string `yaml:"protocol"`
+	// Interval is the time between two exports, 1m when not set
+	Interval time.Duration `yaml:"interval"`
+	// Timeout of a single export, 30s when not set
+	Timeout time.Duration `yaml:"timeout"`
+	// Headers are added to every export, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+}
+
+// validate checks the OTLP settings and fills in their defaults
+func (o *OTLPConfig) validate() error {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("otlp needs an endpoint URL, not %q", o.Endpoint)
+	}
+	switch o.Protocol {
+	case "":
+		o.Protocol = OTLPProtocolHTTP
+	case OTLPProtocolHTTP:
+	case OTLPProtocolGRPC:
+		if u.Scheme != "https" {
+			return fmt.Errorf("otlp grpc needs an https endpoint, use http/protobuf for plain http")
+		}
+	default:
+		return fmt.Errorf("otlp protocol must be %s or %s, not %q", OTLPProtocolHTTP, OTLPProtocolGRPC, o.Protocol)
+	}
+	if o.Interval < 0 || o.Timeout < 0 {
+		return fmt.Errorf("otlp interval and timeout can not be negative")
+	}
+	if o.Interval == 0 {
+		o.Interval = defaultPushInterval
+	}
+	return nil
+}
+
+// AllowedTargetsConfig lists the targets the multi-query endpoints may connect
+// to, as the cluster credentials are sent to every target
+type AllowedTargetsConfig struct {
+	// Hostnames are allowed as is, ignoring case
+	Hostnames []string `yaml:"hostnames"`
+	// CIDRs allow IP address targets in these networks. Hostnames are not
+	// resolved to be checked against them.
+	CIDRs []CIDR `yaml:"cidrs"`
+	// Regexes allow targets matching one of these anchored regexes
+	Regexes []Regexp `yaml:"regexes"`
+}
+
+// validate anchors the regexes, so they have to match the whole target
+func (a *AllowedTargetsConfig) validate() error {
+	for i, re := range a.Regexes {
+		anchored, err := regexp.Compile("^(?:" + re.String() + ")$")
+		if err != nil {
+			return fmt.Errorf("allowed_targets: %s", err)
+		}
+		a.Regexes[i] = Regexp{anchored}
+	}
+	return nil
+}
+
+// CIDR is an IP network that can be read from YAML
+type CIDR struct {
+	*net.IPNet
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *CIDR) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return err
+	}
+	c.IPNet = n
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (c CIDR) MarshalYAML() (interface{}, error) {
+	if c.IPNet == nil {
+		return nil, nil
+	}
+	return c.String(), nil
+}
+
+// TargetAllowed reports whether the query endpoints may connect to a target:
+// the name or address of a configured cluster or a target on the allowlist.
+func (c *Config) TargetAllowed(target string) bool {
+	for _, cl := range c.Clusters {
+		if strings.EqualFold(cl.Name, target) || strings.EqualFold(cl.Address, target) {
+			return true
+		}
+	}
+	for _, h := range c.AllowedTargets.Hostnames {
+		if strings.EqualFold(h, target) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		for _, n := range c.AllowedTargets.CIDRs {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, re := range c.AllowedTargets.Regexes {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetAddress returns the address to connect to for a target: the configured
+// address of the cluster when the target is its name, or else the target.
+func (c *Config) TargetAddress(target string) string {
+	for _, cl := range c.Clusters {
+		if strings.EqualFold(cl.Name, target) && cl.Address != "" {
+			return cl.Address
+		}
+	}
+	return target
+}
+
+// StatisticConfig describes OneFS statistics keys exported as a metric
+type StatisticConfig struct {
+	// Key is the statistics key, or a glob such as node.disk.busy.* matching several keys
+	Key string `yaml:"key"`
+	// Name is the metric name without the emcisi_ prefix. It defaults to the key with
+	// dots replaced by underscores and the base unit of the key appended, e.g. _seconds.
+	// Keys matched by a glob that share a name get a key label.
+	Name string `yaml:"name"`
+	// Help is the metric help text. It defaults to the description of the key
+	// in the statistics key catalog of the cluster.
+	Help string `yaml:"help"`
+	// Type is either gauge (the default) or counter
+	Type string `yaml:"type"`
+	// Scale multiplies every value, e.g. 0.001 to turn milliseconds into seconds. It
+	// defaults to the factor converting the key into its base unit when the name is
+	// derived from the key, and to 1 otherwise.
+	Scale float64 `yaml:"scale"`
+	// Devid is the scope of the key: empty for the cluster total, all for every node
+	// or a comma separated list of device ids. Per node values get a node label.
+	Devid string `yaml:"devid"`
+}
+
+// IsGlob reports whether the key matches several statistics keys
+func (s StatisticConfig) IsGlob() bool {
+	return strings.ContainsAny(s.Key, "*?[")
+}
+
+// metricNameRE matches the valid characters of a metric name
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// invalidMetricChars matches the characters of a statistics key that are
+// replaced in the metric name derived from it
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// devidRE matches the valid devid scopes
+var devidRE = regexp.MustCompile(`^(|all|[0-9]+(,[0-9]+)*)$`)
+
+// validate checks a statistics entry and fills in its defaults
+func (s *StatisticConfig) validate() error {
+	if s.Key == "" {
+		return fmt.Errorf("statistics entry needs a key")
+	}
+	if s.IsGlob() {
+		if _, err := path.Match(s.Key, ""); err != nil {
+			return fmt.Errorf("statistics key %s: %s", s.Key, err)
+		}
+	}
+	if s.Name != "" && !metricNameRE.MatchString(s.Name) {
+		return fmt.Errorf("statistics key %s: invalid metric name %q", s.Key, s.Name)
+	}
+	switch s.Type {
+	case "":
+		s.Type = "gauge"
+	case "gauge", "counter":
+	default:
+		return fmt.Errorf("statistics key %s: type must be gauge or counter, not %q", s.Key, s.Type)
+	}
+	if !devidRE.MatchString(s.Devid) {
+		return fmt.Errorf("statistics key %s: devid must be empty, all or a list of device ids, not %q", s.Key, s.Devid)
+	}
+	return nil
+}
+
+// validateStatistics validates a list of statistics entries and rejects
+// entries that would export the same series twice, which fails the whole
+// scrape. Names derived from a key only gain their unit suffix once the
+// cluster describes the key, so the collector still skips collisions it
+// finds at collect time.
+func validateStatistics(stats []StatisticConfig) error {
+	keys := map[string]bool{}
+	names := map[string]string{}
+	for i := range stats {
+		s := &stats[i]
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if keys[s.Key] {
+			return fmt.Errorf("statistics key %s is listed more than once", s.Key)
+		}
+		keys[s.Key] = true
+		name := s.Name
+		if name == "" {
+			if s.IsGlob() {
+				continue
+			}
+			name = invalidMetricChars.ReplaceAllString(s.Key, "_")
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("statistics keys %s and %s both export metric %s", other, s.Key, name)
+		}
+		names[name] = s.Key
+	}
+	return nil
+}
+
+// Regexp is a regular expression that can be read from YAML
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	re.Regexp = r
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return re.String(), nil
+}
+
+// quotaTypes are the quota types of OneFS
+var quotaTypes = []string{"directory", "user", "group", "default-user", "default-group"}
+
+// validate checks the quota settings
+func (q QuotaConfig) validate() error {
+	if q.MaxSeries < 0 || q.AggregateDepth < 0 {
+		return fmt.Errorf("max_series and aggregate_depth can not be negative")
+	}
+	for _, t := range q.Types {
+		known := false
+		for _, qt := range quotaTypes {
+			known = known || strings.EqualFold(t, qt)
+		}
+		if !known {
+			return fmt.Errorf("unknown quota type %q, must be one of %s", t, strings.Join(quotaTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// Wants reports whether a quota of the given type, path and persona passes the
+// configured filters. The persona filters only apply to user and group quotas,
+// the other types have no persona.
+func (q QuotaConfig) Wants(quotaType, path, persona string) bool {
+	if len(q.Types) > 0 {
+		found := false
+		for _, t := range q.Types {
+			if strings.EqualFold(t, quotaType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !filter(path, q.IncludePaths, q.ExcludePaths) {
+		return false
+	}
+	if !strings.EqualFold(quotaType, "user") && !strings.EqualFold(quotaType, "group") {
+		return true
+	}
+	return filter(persona, q.IncludePersonas, q.ExcludePersonas)
+}
+
+// filter returns true if s matches any of the include regexes (or there are
+// none) and none of the exclude regexes.
+func filter(s string, include, exclude []Regexp) bool {
+	for _, re := range exclude {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, re := range include {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFile reads the YAML configuration file into cfg
+func loadFile(filename string, cfg *Config) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fc := fileConfig{}
+	if err := yaml.UnmarshalStrict(content, &fc); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if err := fc.expandEnv(); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	for i, cl := range fc.Clusters {
+		if cl.Name == "" && cl.Address == "" {
+			return fmt.Errorf("parsing %s: cluster %d needs a name or an address", filename, i+1)
+		}
+		if strings.Contains(cl.Address, ":") {
+			return fmt.Errorf("parsing %s: cluster %d: IPv6 addresses are not supported, use a hostname", filename, i+1)
+		}
+		if cl.Quota != nil {
+			if err := cl.Quota.validate(); err != nil {
+				return fmt.Errorf("parsing %s: cluster %d: %s", filename, i+1, err)
+			}
+		}
+		if cl.Event != nil && cl.Event.MaxActiveInfo < 0 {
+			return fmt.Errorf("parsing %s: cluster %d: max_active_info can not be negative", filename, i+1)
+		}
+		if cl.Polling != nil {
+			if err := cl.Polling.validate(); err != nil {
+				return fmt.Errorf("parsing %s: cluster %d: %s", filename, i+1, err)
+			}
+		}
+		if err := validateStatistics(cl.Statistics); err != nil {
+			return fmt.Errorf("parsing %s: cluster %d: %s", filename, i+1, err)
+		}
+		if err := validateLabels(cl.Labels); err != nil {
+			return fmt.Errorf("parsing %s: cluster %d: %s", filename, i+1, err)
+		}
+	}
+	if err := validateStatistics(fc.Statistics); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if err := fc.Quota.validate(); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if fc.Event.MaxActiveInfo < 0 {
+		return fmt.Errorf("parsing %s: max_active_info can not be negative", filename)
+	}
+	if err := fc.Polling.validate(); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if err := fc.Push.validate(); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if fc.OTLP != nil {
+		if err := fc.OTLP.validate(); err != nil {
+			return fmt.Errorf("parsing %s: %s", filename, err)
+		}
+	}
+	if err := fc.AllowedTargets.validate(); err != nil {
+		return fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	if err := validateLabels(fc.ServiceDiscovery.Labels); err != nil {
+		return fmt.Errorf("parsing %s: service_discovery: %s", filename, err)
+	}
+	if fc.Credentials != nil && fc.Credentials.Vault != nil {
+		if err := fc.Credentials.Vault.validate(); err != nil {
+			return fmt.Errorf("parsing %s: %s", filename, err)
+		}
+	}
+	cfg.Quota = fc.Quota
+	cfg.Event = fc.Event
+	cfg.Statistics = fc.Statistics
+	cfg.Polling = fc.Polling
+	cfg.Collectors = fc.Collectors
+	cfg.Push = fc.Push
+	cfg.OTLP = fc.OTLP
+	cfg.AllowedTargets = fc.AllowedTargets
+	cfg.ServiceDiscovery = fc.ServiceDiscovery
+	if fc.Credentials != nil {
+		cfg.ISI.Credentials.merge(fc.Credentials)
+	}
+	cfg.Clusters = fc.Clusters
+	return nil
+}
+
+// expandEnv replaces the environment variable references in the credentials,
+// addresses, URLs and tokens of the file. They are replaced after parsing, so
+// the values of the variables are never read as YAML.
+func (fc *fileConfig) expandEnv() error {
+	var fields []*string
+	if c := fc.Credentials; c != nil {
+		fields = append(fields, &c.UserName, &c.Password, &c.PasswordFile)
+		if v := c.Vault; v != nil {
+			fields = append(fields, &v.Address, &v.Token, &v.TokenFile, &v.Namespace, &v.Mount, &v.Path)
+		}
+	}
+	endpoints := []*PushEndpoint{fc.Push.Pushgateway, fc.Push.RemoteWrite}
+	if i := fc.Push.InfluxDB; i != nil {
+		endpoints = append(endpoints, &i.PushEndpoint)
+		fields = append(fields, &i.Org, &i.Bucket, &i.Token)
+	}
+	for _, e := range endpoints {
+		if e == nil {
+			continue
+		}
+		fields = append(fields, &e.URL, &e.BearerToken)
+		if e.BasicAuth != nil {
+			fields = append(fields, &e.BasicAuth.Username, &e.BasicAuth.Password)
+		}
+	}
+	headers := map[string]*string{}
+	if o := fc.OTLP; o != nil {
+		fields = append(fields, &o.Endpoint)
+		for name, value := range o.Headers {
+			value := value
+			headers[name] = &value
+			fields = append(fields, &value)
+		}
+	}
+	for i := range fc.Clusters {
+		fields = append(fields, &fc.Clusters[i].Address)
+	}
+	if err := expandEnv(fields...); err != nil {
+		return err
+	}
+	for name, value := range headers {
+		fc.OTLP.Headers[name] = *value
+	}
+	return nil
+}
+
+// Cluster returns the settings of the first configured cluster whose name or
+// address matches one of keys. Clusters that are not configured get the defaults.
+func (c *Config) Cluster(keys ...string) ClusterConfig {
+	for _, cl := range c.Clusters {
+		for _, k := range keys {
+			if k == "" {
+				continue
+			}
+			if strings.EqualFold(cl.Name, k) || strings.EqualFold(cl.Address, k) {
+				if cl.Quota == nil {
+					cl.Quota = &c.Quota
+				}
+				if cl.Event == nil {
+					cl.Event = &c.Event
+				}
+				if cl.Statistics == nil {
+					cl.Statistics = c.Statistics
+				}
+				if cl.Polling == nil {
+					cl.Polling = &c.Polling
+				}
+				if cl.Collectors == nil {
+					cl.Collectors = &c.Collectors
+				}
+				return cl
+			}
+		}
+	}
+	return ClusterConfig{Quota: &c.Quota, Event: &c.Event, Statistics: c.Statistics, Polling: &c.Polling, Collectors: &c.Collectors}
+}
+
+// Targets returns the address of every configured cluster, or its name when no
+// address is given.
+func (c *Config) Targets() (targets []string) {
+	for _, cl := range c.Clusters {
+		if cl.Address != "" {
+			targets = append(targets, cl.Address)
+		} else {
+			targets = append(targets, cl.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package isiconfig
+
+import (
+	"regexp"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// allowedTargets reads and validates an allowed_targets section
+func allowedTargets(t *testing.T, section string) AllowedTargetsConfig {
+	t.Helper()
+	var a AllowedTargetsConfig
+	if err := yaml.UnmarshalStrict([]byte(section), &a); err != nil {
+		t.Fatalf("unable to read allowed_targets: %s", err)
+	}
+	if err := a.validate(); err != nil {
+		t.Fatalf("invalid allowed_targets: %s", err)
+	}
+	return a
+}
+
+func TestAllowedTargetsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		regex    string
+		match    []string
+		mismatch []string
+	}{
+		{
+			regex:    `isilon[0-9]+\.corp\.com`,
+			match:    []string{"isilon1.corp.com", "isilon12.corp.com"},
+			mismatch: []string{"isilon1.corp.com.evil.org", "evil.isilon1.corp.com", "xisilon1.corp.com"},
+		},
+		{
+			// The alternation is anchored as a whole
+			regex:    `a|b`,
+			match:    []string{"a", "b"},
+			mismatch: []string{"ab", "xa", "bx"},
+		},
+		{
+			regex:    `^nas-.*$`,
+			match:    []string{"nas-01"},
+			mismatch: []string{"xnas-01"},
+		},
+	} {
+		a := AllowedTargetsConfig{Regexes: []Regexp{{regexp.MustCompile(tc.regex)}}}
+		if err := a.validate(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", tc.regex, err)
+		}
+		for _, target := range tc.match {
+			if !a.Regexes[0].MatchString(target) {
+				t.Errorf("%s does not match %s", tc.regex, target)
+			}
+		}
+		for _, target := range tc.mismatch {
+			if a.Regexes[0].MatchString(target) {
+				t.Errorf("%s matches %s", tc.regex, target)
+			}
+		}
+	}
+}
+
+func TestTargetAllowed(t *testing.T) {
+	cfg := &Config{
+		Clusters: []ClusterConfig{
+			{Name: "isi01", Address: "10.1.0.5"},
+			{Name: "isi02", Address: "isi02.corp.com"},
+		},
+		AllowedTargets: allowedTargets(t, `
+hostnames: [Isilon9.corp.com]
+cidrs: [192.168.10.0/24]
+regexes: ['isilon[0-9]+\.corp\.com']
+`),
+	}
+	for _, tc := range []struct {
+		target  string
+		allowed bool
+	}{
+		{"isi01", true},
+		{"ISI01", true},
+		{"10.1.0.5", true},
+		{"isi02.corp.com", true},
+		{"ISI02.CORP.COM", true},
+		{"isi03", false},
+
+		{"isilon9.corp.com", true},
+		{"ISILON9.CORP.COM", true},
+		{"isilon9.corp.com.evil.org", false},
+
+		{"192.168.10.1", true},
+		{"192.168.10.255", true},
+		{"192.168.11.1", false},
+		// Hostnames are not resolved to be checked against the networks
+		{"localhost", false},
+		{"192.168.10.1.nip.io", false},
+
+		{"isilon1.corp.com", true},
+		{"isilon12.corp.com", true},
+		{"isilon1.corp.com.evil.org", false},
+		{"evil.isilon1.corp.com", false},
+	} {
+		if got := cfg.TargetAllowed(tc.target); got != tc.allowed {
+			t.Errorf("TargetAllowed(%q) = %t, want %t", tc.target, got, tc.allowed)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package isiconfig
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reloader reads the flags and configuration file again when asked to and
+// hands the new configuration to Apply. A configuration that fails to load or
+// to apply leaves the current one in place.
+type Reloader struct {
+	// Apply puts a loaded configuration in place, or fails without changing anything
+	Apply func(*Config) error
+
+	mtx         sync.Mutex
+	stopped     bool
+	successful  prometheus.Gauge
+	lastSuccess prometheus.Gauge
+}
+
+// NewReloader returns a Reloader for a configuration loaded successfully just now.
+func NewReloader(apply func(*Config) error) *Reloader {
+	r := &Reloader{
+		Apply: apply,
+		successful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "emcisi_config_last_reload_successful",
+			Help: "Indicates if the last configuration reload was successful (1) or not (0).",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "emcisi_config_last_reload_success_timestamp_seconds",
+			Help: "Unix time of the last successful configuration reload.",
+		}),
+	}
+	r.succeeded()
+	return r
+}
+
+// Reload loads the configuration and applies it. Reloads run one at a time.
+func (r *Reloader) Reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.stopped {
+		return errors.New("shutting down")
+	}
+	cfg, err := GetConfig()
+	if err == nil {
+		err = r.Apply(cfg)
+	}
+	if err != nil {
+		r.successful.Set(0)
+		return err
+	}
+	r.succeeded()
+	return nil
+}
+
+// Stop waits for a running reload to finish and refuses any further reloads.
+func (r *Reloader) Stop() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.stopped = true
+}
+
+// succeeded records a successful load
+func (r *Reloader) succeeded() {
+	r.successful.Set(1)
+	r.lastSuccess.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// Describe implements prometheus.Collector.
+func (r *Reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.successful.Describe(ch)
+	r.lastSuccess.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *Reloader) Collect(ch chan<- prometheus.Metric) {
+	r.successful.Collect(ch)
+	r.lastSuccess.Collect(ch)
+}
@@ -0,0 +1,172 @@
+package isiconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// Vault defaults
+const (
+	defaultVaultMount   = "secret"
+	defaultVaultRefresh = 5 * time.Minute
+	vaultTimeout        = 10 * time.Second
+)
+
+// VaultConfig locates a secret in the KV secrets engine of a HashiCorp Vault
+type VaultConfig struct {
+	// Address is the URL of the Vault, e.g. https://vault.example.com:8200
+	Address string `yaml:"address"`
+	// Token authenticates with Vault. TokenFile is read on every refresh
+	// instead, for tokens renewed by a Vault agent.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string `yaml:"namespace"`
+	// Mount is the path the KV engine is mounted at, secret when not set
+	Mount string `yaml:"mount"`
+	// Path is the path of the secret within the engine
+	Path string `yaml:"path"`
+	// KVVersion is the version of the KV engine, 1 or 2 (the default)
+	KVVersion int `yaml:"kv_version"`
+	// RefreshInterval is how long the secret is cached, 5m when not set
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// validate checks the Vault settings and fills in their defaults
+func (v *VaultConfig) validate() error {
+	if v.Address == "" || v.Path == "" {
+		return fmt.Errorf("vault needs an address and a path")
+	}
+	if v.Token != "" && v.TokenFile != "" {
+		return fmt.Errorf("vault can use either token or token_file, not both")
+	}
+	if v.Mount == "" {
+		v.Mount = defaultVaultMount
+	}
+	switch v.KVVersion {
+	case 0:
+		v.KVVersion = 2
+	case 1, 2:
+	default:
+		return fmt.Errorf("vault kv_version must be 1 or 2")
+	}
+	if v.RefreshInterval < 0 {
+		return fmt.Errorf("vault refresh_interval can not be negative")
+	}
+	if v.RefreshInterval == 0 {
+		v.RefreshInterval = defaultVaultRefresh
+	}
+	return nil
+}
+
+// VaultKV is a SecretProvider reading the keys of a Vault KV secret. The
+// secret is cached for the refresh interval, and the cached secret is kept
+// until the next refresh when Vault can not be reached.
+type VaultKV struct {
+	Config     VaultConfig
+	HTTPClient *http.Client
+
+	mtx     sync.Mutex
+	data    map[string]interface{}
+	fetched time.Time
+}
+
+// NewVaultKV returns a VaultKV for the configured secret.
+func NewVaultKV(cfg VaultConfig) *VaultKV {
+	return &VaultKV{Config: cfg, HTTPClient: &http.Client{Timeout: vaultTimeout}}
+}
+
+// Secret implements SecretProvider.
+func (v *VaultKV) Secret(key string) (string, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.fetched.IsZero() || time.Since(v.fetched) >= v.Config.RefreshInterval {
+		data, err := v.fetch()
+		switch {
+		case err == nil:
+			v.data, v.fetched = data, time.Now()
+		case v.fetched.IsZero():
+			return "", err
+		default:
+			// Try again on the next refresh rather than on every request
+			v.fetched = time.Now()
+			log.Infof("Unable to refresh the Vault secret %s, keeping the cached one: %s", v.Config.Path, err)
+		}
+	}
+	value, ok := v.data[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", v.Config.Path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// secretResponse is the part of a Vault KV read response holding the secret.
+// Version 2 of the engine nests it in a second data field.
+type secretResponse struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// fetch reads the key value pairs of the secret
+func (v *VaultKV) fetch() (map[string]interface{}, error) {
+	token := v.Config.Token
+	if v.Config.TokenFile != "" {
+		content, err := ioutil.ReadFile(v.Config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(content))
+	}
+
+	mount, path := strings.Trim(v.Config.Mount, "/"), strings.Trim(v.Config.Path, "/")
+	u := strings.TrimSuffix(v.Config.Address, "/") + "/v1/" + mount + "/" + path
+	if v.Config.KVVersion == 2 {
+		u = strings.TrimSuffix(v.Config.Address, "/") + "/v1/" + mount + "/data/" + path
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.Config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Config.Namespace)
+	}
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading vault secret %s: unexpected status %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var r secretResponse
+	err = json.Unmarshal(body, &r)
+	if err == nil && v.Config.KVVersion == 2 {
+		raw := r.Data
+		r.Data = nil
+		err = json.Unmarshal(raw, &r)
+	}
+	var data map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(r.Data, &data)
+	}
+	if err != nil || data == nil {
+		return nil, fmt.Errorf("reading vault secret %s: no data in the response", path)
+	}
+	return data, nil
+}
@@ -0,0 +1,143 @@
+// Package influx renders Prometheus metric families in the InfluxDB line
+// protocol.
+//
+// A metric name is split after its second part into the measurement and the
+// field, so emcisi_cluster_ifs_bytes_avail becomes the field ifs_bytes_avail of
+// the measurement emcisi_cluster. Labels become tags, leaving out empty ones,
+// and series of a measurement with the same tags are written as one line.
+// Summaries and histograms are written as their _sum and _count fields and a
+// line per quantile or bucket with a quantile or le tag.
+package influx
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Split returns the measurement and field a metric name is written as.
+func Split(name string) (measurement, field string) {
+	parts := strings.SplitN(name, "_", 3)
+	switch len(parts) {
+	case 3:
+		return parts[0] + "_" + parts[1], parts[2]
+	case 2:
+		return parts[0], parts[1]
+	}
+	return name, "value"
+}
+
+// point is a line of the line protocol
+type point struct {
+	measurement string
+	tags        string
+	timestamp   int64
+	fields      []string
+}
+
+// Write writes the metric families as line protocol. Samples without a
+// timestamp are taken at now. Values that are not finite are left out as
+// InfluxDB can not store them.
+func Write(out io.Writer, families []*dto.MetricFamily, now time.Time) error {
+	points := map[string]*point{}
+	var order []string
+	add := func(name string, m *dto.Metric, value float64, extraName, extraValue string) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		measurement, field := Split(name)
+		tags := tagString(m.Label, extraName, extraValue)
+		ts := now.UnixNano()
+		if m.TimestampMs != nil {
+			ts = m.GetTimestampMs() * int64(time.Millisecond)
+		}
+		key := measurement + tags + " " + strconv.FormatInt(ts, 10)
+		p, ok := points[key]
+		if !ok {
+			p = &point{measurement: measurement, tags: tags, timestamp: ts}
+			points[key] = p
+			order = append(order, key)
+		}
+		p.fields = append(p.fields, escape(field, fieldEscaper)+"="+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.Counter.GetValue(), "", "")
+			case dto.MetricType_GAUGE:
+				add(name, m, m.Gauge.GetValue(), "", "")
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.Summary.Quantile {
+					add(name, m, q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add(name+"_sum", m, m.Summary.GetSampleSum(), "", "")
+				add(name+"_count", m, float64(m.Summary.GetSampleCount()), "", "")
+			case dto.MetricType_HISTOGRAM:
+				for _, b := range m.Histogram.Bucket {
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				add(name+"_bucket", m, float64(m.Histogram.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", m, m.Histogram.GetSampleSum(), "", "")
+				add(name+"_count", m, float64(m.Histogram.GetSampleCount()), "", "")
+			default:
+				add(name, m, m.Untyped.GetValue(), "", "")
+			}
+		}
+	}
+
+	sort.Strings(order)
+	w := bufio.NewWriter(out)
+	for _, key := range order {
+		p := points[key]
+		w.WriteString(escape(p.measurement, measurementEscaper))
+		w.WriteString(p.tags)
+		w.WriteString(" ")
+		w.WriteString(strings.Join(p.fields, ","))
+		w.WriteString(" ")
+		w.WriteString(strconv.FormatInt(p.timestamp, 10))
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
+
+// tagString formats the labels as the tag set of a line sorted by key, with
+// an optional extra tag
+func tagString(labels []*dto.LabelPair, extraName, extraValue string) string {
+	pairs := make([][2]string, 0, len(labels)+1)
+	for _, l := range labels {
+		if l.GetValue() != "" {
+			pairs = append(pairs, [2]string{l.GetName(), l.GetValue()})
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, [2]string{extraName, extraValue})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	var b strings.Builder
+	for _, p := range pairs {
+		b.WriteString("," + escape(p[0], fieldEscaper) + "=" + escape(p[1], fieldEscaper))
+	}
+	return b.String()
+}
+
+var (
+	// measurementEscaper escapes measurement names
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	// fieldEscaper escapes tag keys, tag values and field keys
+	fieldEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// escape escapes s and drops line breaks, which the line protocol can not hold
+func escape(s string, r *strings.Replacer) string {
+	s = strings.Replace(strings.Replace(s, "\r", " ", -1), "\n", " ", -1)
+	return r.Replace(s)
+}
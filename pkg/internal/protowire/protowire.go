@@ -0,0 +1,41 @@
+// Package protowire appends protobuf fields to a buffer, for the messages the
+// exporter encodes by hand instead of pulling in their generated code.
+package protowire
+
+import (
+	proto "github.com/golang/protobuf/proto"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// EncodeVarint appends a varint field
+func EncodeVarint(b *proto.Buffer, field uint64, value uint64) {
+	b.EncodeVarint(field<<3 | wireVarint)
+	b.EncodeVarint(value)
+}
+
+// EncodeFixed64 appends a fixed64 or double field
+func EncodeFixed64(b *proto.Buffer, field uint64, value uint64) {
+	b.EncodeVarint(field<<3 | wireFixed64)
+	b.EncodeFixed64(value)
+}
+
+// EncodeBytes appends a length delimited field
+func EncodeBytes(b *proto.Buffer, field uint64, value []byte) {
+	b.EncodeVarint(field<<3 | wireBytes)
+	b.EncodeRawBytes(value)
+}
+
+// EncodeString appends a string field, leaving out empty strings as proto3 does
+func EncodeString(b *proto.Buffer, field uint64, value string) {
+	if value == "" {
+		return
+	}
+	b.EncodeVarint(field<<3 | wireBytes)
+	b.EncodeStringBytes(value)
+}
@@ -0,0 +1,200 @@
+// Package protowiretest decodes the messages encoded with protowire in tests.
+package protowiretest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// Wire types of the protobuf struct tags
+var wireTypes = map[string]uint64{
+	"varint":  proto.WireVarint,
+	"fixed64": proto.WireFixed64,
+	"bytes":   proto.WireBytes,
+}
+
+// field is a field of a message struct
+type field struct {
+	index  int
+	wire   uint64
+	packed bool
+}
+
+// Unmarshal decodes the message b into v, a pointer to a struct whose fields
+// carry the protobuf struct tags protoc-gen-go generates for the message, e.g.
+// `protobuf:"fixed64,4,opt,name=as_double"`. Unlike proto.Unmarshal it needs
+// no generated methods, and it fails on a field the struct does not declare or
+// on a wire type other than the declared one, so an encoder writing a wrong
+// field number or type is noticed.
+func Unmarshal(b []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can not decode into %T", v)
+	}
+	return decode(b, rv.Elem())
+}
+
+// String returns v indented, for test failures
+func String(v interface{}) string {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// fields returns the fields of a message struct by field number
+func fields(t reflect.Type) (map[uint64]field, error) {
+	fs := map[uint64]field{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("protobuf"), ",")
+		if len(tag) < 3 {
+			return nil, fmt.Errorf("%s.%s has no protobuf tag", t, t.Field(i).Name)
+		}
+		wire, ok := wireTypes[tag[0]]
+		n, err := strconv.ParseUint(tag[1], 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s.%s has an invalid protobuf tag", t, t.Field(i).Name)
+		}
+		f := field{index: i, wire: wire}
+		for _, option := range tag[2:] {
+			f.packed = f.packed || option == "packed"
+		}
+		fs[n] = f
+	}
+	return fs, nil
+}
+
+// decode decodes the message b into the struct v
+func decode(b []byte, v reflect.Value) error {
+	fs, err := fields(v.Type())
+	if err != nil {
+		return err
+	}
+	for len(b) > 0 {
+		key, n := proto.DecodeVarint(b)
+		if n == 0 {
+			return fmt.Errorf("%s: truncated field key", v.Type())
+		}
+		b = b[n:]
+		number, wire := key>>3, key&7
+		f, ok := fs[number]
+		if !ok {
+			return fmt.Errorf("%s: unknown field %d", v.Type(), number)
+		}
+		dst := v.Field(f.index)
+		expected := f.wire
+		if f.packed {
+			expected = proto.WireBytes
+		}
+		if wire != expected {
+			return fmt.Errorf("%s: field %d has wire type %d, not %d", v.Type(), number, wire, expected)
+		}
+
+		var value []byte
+		value, b, err = next(b, wire)
+		if err != nil {
+			return fmt.Errorf("%s: field %d: %s", v.Type(), number, err)
+		}
+		if f.packed {
+			for len(value) > 0 {
+				var element []byte
+				if element, value, err = next(value, f.wire); err != nil {
+					return fmt.Errorf("%s: field %d: %s", v.Type(), number, err)
+				}
+				if err := set(dst, f.wire, element); err != nil {
+					return fmt.Errorf("%s: field %d: %s", v.Type(), number, err)
+				}
+			}
+			continue
+		}
+		if err := set(dst, wire, value); err != nil {
+			return fmt.Errorf("%s: field %d: %s", v.Type(), number, err)
+		}
+	}
+	return nil
+}
+
+// next splits the value of a field of the given wire type off b. Varints and
+// fixed64 values are returned as they are encoded, length delimited values
+// without their length.
+func next(b []byte, wire uint64) (value, rest []byte, err error) {
+	switch wire {
+	case proto.WireVarint:
+		_, n := proto.DecodeVarint(b)
+		if n == 0 {
+			return nil, nil, fmt.Errorf("truncated varint")
+		}
+		return b[:n], b[n:], nil
+	case proto.WireFixed64:
+		if len(b) < 8 {
+			return nil, nil, fmt.Errorf("truncated fixed64")
+		}
+		return b[:8], b[8:], nil
+	case proto.WireBytes:
+		l, n := proto.DecodeVarint(b)
+		if n == 0 || uint64(len(b)-n) < l {
+			return nil, nil, fmt.Errorf("truncated length delimited value")
+		}
+		return b[n : n+int(l)], b[n+int(l):], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported wire type %d", wire)
+}
+
+// set stores a value in dst, appending it if dst is a repeated field
+func set(dst reflect.Value, wire uint64, value []byte) error {
+	if dst.Kind() == reflect.Slice {
+		element := reflect.New(dst.Type().Elem()).Elem()
+		if err := set(element, wire, value); err != nil {
+			return err
+		}
+		dst.Set(reflect.Append(dst, element))
+		return nil
+	}
+	switch wire {
+	case proto.WireVarint:
+		x, _ := proto.DecodeVarint(value)
+		switch dst.Kind() {
+		case reflect.Bool:
+			dst.SetBool(x != 0)
+			return nil
+		case reflect.Int32, reflect.Int64:
+			dst.SetInt(int64(x))
+			return nil
+		case reflect.Uint32, reflect.Uint64:
+			dst.SetUint(x)
+			return nil
+		}
+	case proto.WireFixed64:
+		x := binary.LittleEndian.Uint64(value)
+		switch dst.Kind() {
+		case reflect.Uint64:
+			dst.SetUint(x)
+			return nil
+		case reflect.Float64:
+			dst.SetFloat(math.Float64frombits(x))
+			return nil
+		}
+	case proto.WireBytes:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(value))
+			return nil
+		case dst.Kind() == reflect.Ptr && dst.Type().Elem().Kind() == reflect.Struct:
+			m := reflect.New(dst.Type().Elem())
+			if err := decode(value, m.Elem()); err != nil {
+				return err
+			}
+			dst.Set(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("can not store wire type %d in %s", wire, dst.Type())
+}
@@ -3,9 +3,11 @@ package isiclient
 import (
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/tidwall/gjson"
@@ -13,13 +15,19 @@ import (
 	"github.com/prometheus/common/log"
 )
 
+// Credentials supplies the user name and password sent to a cluster. They are
+// asked for on every request, so they can change while the exporter runs.
+type Credentials interface {
+	Get() (user, pass string, err error)
+}
+
 // ISIClient is used to connect to an EMC Isilon Cluster
 type ISIClient struct {
-	UserName       string
-	Password       string
+	Credentials    Credentials
 	authToken      string
 	ClusterAddress string
 	ClusterName    string
+	ClusterGUID    string
 	ISIVersion     string
 	NumNodes       int64
 	ErrorCount     float64
@@ -29,25 +37,38 @@ type ISIClient struct {
 // CallIsiAPI uses the client auth to call against an API endpoint and returns the string response
 func (c *ISIClient) CallIsiAPI(request string, retryAttempts int) (response string, err error) {
 
+	user, pass, err := c.Credentials.Get()
+	if err != nil {
+		log.Infof("Unable to get the Isilon credentials: %s", err)
+		return "", err
+	}
 	req, _ := http.NewRequest("GET", request, nil)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(c.UserName, c.Password)
+	req.SetBasicAuth(user, pass)
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		observeCall(c.ClusterAddress, req.Method, req.URL.Path, 0, time.Since(start), 0)
+		recordCall(c.ClusterAddress, time.Since(start), err)
 		log.Infof("\n - Error connecting to Isilon: %s", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 	respText, _ := ioutil.ReadAll(resp.Body)
+	latency := time.Since(start)
+	observeCall(c.ClusterAddress, req.Method, req.URL.Path, resp.StatusCode, latency, len(respText))
 	s := string(respText)
 	if resp.StatusCode == 200 {
+		recordCall(c.ClusterAddress, latency, nil)
 		log.Debugln(s)
 	} else {
+		recordCall(c.ClusterAddress, latency, fmt.Errorf("unexpected status %s from %s", resp.Status, req.URL.Path))
 		if retryAttempts >= 1 {
 			log.Infof("Got unknown code: %v when accessing URL: %s\n Body text is: %s\n", resp.StatusCode, request, respText)
 			// to do need to re-auth to get back into system
 			log.Info("retrying command")
+			apiRetries.WithLabelValues(c.ClusterAddress, endpoint(req.URL.Path)).Inc()
 			// now lets recursively call ourselves and hopefully we get in again
 			s, _ = c.CallIsiAPI(request, retryAttempts-1)
 			c.ErrorCount++
@@ -58,14 +79,41 @@ func (c *ISIClient) CallIsiAPI(request string, retryAttempts int) (response stri
 	return s, nil
 }
 
+// CallIsiAPIPages calls a collection endpoint and follows the resume tokens
+// returned by the cluster until every page has been read. It returns the raw
+// response of each page.
+func (c *ISIClient) CallIsiAPIPages(request string, retryAttempts int) (pages []string, err error) {
+	u, err := url.Parse(request)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		s, err := c.CallIsiAPI(request, retryAttempts)
+		if err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return nil, errors.New("empty response from " + u.Path)
+		}
+		pages = append(pages, s)
+
+		resume := gjson.Get(s, "resume").String()
+		if resume == "" {
+			return pages, nil
+		}
+		// OneFS does not accept any other query arguments alongside a resume token
+		u.RawQuery = url.Values{"resume": []string{resume}}.Encode()
+		request = u.String()
+	}
+}
+
 // NewIsiClient returns an initialized Isilon Client.
-func NewIsiClient(user string, pass string, target string) (*ISIClient, error) {
+func NewIsiClient(creds Credentials, target string) (*ISIClient, error) {
 
 	log.Debugln("Init ISI Client")
 
 	c := ISIClient{
-		UserName:       user,
-		Password:       pass,
+		Credentials:    creds,
 		ClusterAddress: target,
 		httpClient: &http.Client{Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -88,16 +136,29 @@ func NewIsiClient(user string, pass string, target string) (*ISIClient, error) {
 	// make a quick call to the API and ensure that it works
 	s, err := c.CallIsiAPI(reqStatusURL, 2)
 	if err != nil {
+		c.Close()
 		return nil, errors.New("error creating connection")
 	}
 	if s != "" {
 		c.ClusterName = gjson.Get(s, "name").String()
+		c.ClusterGUID = gjson.Get(s, "guid").String()
 		c.ISIVersion = gjson.Get(s, "onefs_version.release").String()
 		c.NumNodes = gjson.Get(s, "devices.#").Int()
+		recordConnect(&c)
 
 		return &c, nil
 	}
 
+	c.Close()
 	return nil, errors.New("error creating connection")
 
 }
+
+// Close closes the idle connections of the client. Every request is
+// authenticated on its own, so there is no OneFS session to log out of.
+func (c *ISIClient) Close() {
+	if c == nil {
+		return
+	}
+	c.httpClient.CloseIdleConnections()
+}
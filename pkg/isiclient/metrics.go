@@ -0,0 +1,130 @@
+package isiclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "emcisi_api_requests_total",
+			Help: "Number of OneFS API requests, by cluster address, endpoint, method and HTTP status code or error.",
+		},
+		[]string{"cluster", "endpoint", "method", "code"},
+	)
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "emcisi_api_request_duration_seconds",
+			Help:    "Duration of OneFS API requests, including reading the response, by cluster address and endpoint.",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"cluster", "endpoint"},
+	)
+	apiResponseBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "emcisi_api_response_bytes",
+			Help:    "Size of OneFS API responses, by cluster address and endpoint.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+		},
+		[]string{"cluster", "endpoint"},
+	)
+	apiRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "emcisi_api_retries_total",
+			Help: "Number of OneFS API requests retried after an unexpected status, by cluster address and endpoint.",
+		},
+		[]string{"cluster", "endpoint"},
+	)
+	apiAuthFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "emcisi_api_auth_failures_total",
+			Help: "Number of OneFS API requests refused with 401 Unauthorized or 403 Forbidden, by cluster address.",
+		},
+		[]string{"cluster"},
+	)
+)
+
+// Metrics collects the metrics of the API requests of every client.
+var Metrics prometheus.Collector = apiMetrics{}
+
+type apiMetrics struct{}
+
+// Describe implements prometheus.Collector.
+func (apiMetrics) Describe(ch chan<- *prometheus.Desc) {
+	apiRequests.Describe(ch)
+	apiRequestDuration.Describe(ch)
+	apiResponseBytes.Describe(ch)
+	apiRetries.Describe(ch)
+	apiAuthFailures.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (apiMetrics) Collect(ch chan<- prometheus.Metric) {
+	apiRequests.Collect(ch)
+	apiRequestDuration.Collect(ch)
+	apiResponseBytes.Collect(ch)
+	apiRetries.Collect(ch)
+	apiAuthFailures.Collect(ch)
+}
+
+// collections are the API collections whose members are addressed by an id
+// or name in the path, relative to the API version
+var collections = []string{
+	"/cluster/nodes",
+	"/dedupe/reports",
+	"/event/eventgroup-occurrences",
+	"/protocols/ntp/servers",
+	"/quota/quotas",
+	"/statistics/keys",
+	"/storagepool/nodepools",
+	"/sync/policies",
+	"/upgrade/cluster/nodes",
+	"/upgrade/patch/patches",
+	"/zones",
+}
+
+// endpoint returns the path template of an API path, replacing the id of a
+// collection member with {id}, so the endpoint label stays low-cardinality.
+func endpoint(path string) string {
+	segments := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	if len(segments) < 3 || segments[0] != "platform" {
+		return path
+	}
+	rest := "/" + segments[2]
+	for _, c := range collections {
+		if !strings.HasPrefix(rest, c+"/") {
+			continue
+		}
+		member := rest[len(c)+1:]
+		sub := ""
+		if i := strings.Index(member, "/"); i >= 0 {
+			sub = member[i:]
+		}
+		return "/platform/" + segments[1] + c + "/{id}" + sub
+	}
+	return "/platform/" + segments[1] + rest
+}
+
+// observeCall records an API request answered with status, 0 when no
+// response was received
+func observeCall(cluster, method, path string, status int, latency time.Duration, size int) {
+	e := endpoint(path)
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	apiRequests.WithLabelValues(cluster, e, method, code).Inc()
+	apiRequestDuration.WithLabelValues(cluster, e).Observe(latency.Seconds())
+	if status == 0 {
+		return
+	}
+	apiResponseBytes.WithLabelValues(cluster, e).Observe(float64(size))
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		apiAuthFailures.WithLabelValues(cluster).Inc()
+	}
+}
@@ -0,0 +1,45 @@
+package isiclient
+
+import "testing"
+
+func TestEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		path, want string
+	}{
+		// Collections and their members
+		{"/platform/3/cluster/nodes", "/platform/3/cluster/nodes"},
+		{"/platform/3/cluster/nodes/4", "/platform/3/cluster/nodes/{id}"},
+		{"/platform/1/quota/quotas/AABpAQEAAAAAAAAAAAAAQA0AAAAAAAAA", "/platform/1/quota/quotas/{id}"},
+		{"/platform/1/statistics/keys/node.disk.busy.1", "/platform/1/statistics/keys/{id}"},
+		{"/platform/1/sync/policies/nightly", "/platform/1/sync/policies/{id}"},
+		{"/platform/3/upgrade/cluster/nodes/2", "/platform/3/upgrade/cluster/nodes/{id}"},
+		{"/platform/1/zones/System", "/platform/1/zones/{id}"},
+
+		// Sub-resources of a member keep their path
+		{"/platform/3/cluster/nodes/4/drives", "/platform/3/cluster/nodes/{id}/drives"},
+		{"/platform/3/cluster/nodes/4/status/batterystatus", "/platform/3/cluster/nodes/{id}/status/batterystatus"},
+
+		// A trailing slash is not a member
+		{"/platform/1/quota/quotas/", "/platform/1/quota/quotas"},
+
+		// Paths that are not a collection are kept as they are
+		{"/platform/1/cluster/config", "/platform/1/cluster/config"},
+		{"/platform/3/statistics/summary/drive", "/platform/3/statistics/summary/drive"},
+		{"/platform/1/statistics/current", "/platform/1/statistics/current"},
+		{"/platform/1/dedupe/dedupe-summary", "/platform/1/dedupe/dedupe-summary"},
+
+		// Paths with only a version
+		{"/platform/1", "/platform/1"},
+		{"/platform/1/", "/platform/1/"},
+		{"/platform", "/platform"},
+
+		// Paths outside /platform
+		{"/session/1/session", "/session/1/session"},
+		{"/namespace/ifs/data", "/namespace/ifs/data"},
+		{"/", "/"},
+	} {
+		if got := endpoint(tc.path); got != tc.want {
+			t.Errorf("endpoint(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package isiclient
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is the state of the API of a cluster as seen by the exporter
+type Status struct {
+	Address string
+	// Name and Version are those of the last successful connection
+	Name    string
+	Version string
+	// LastSuccess is the time of the last successful API call
+	LastSuccess time.Time
+	// LastError is the error of the last API call that failed, and LastErrorTime its time
+	LastError     string
+	LastErrorTime time.Time
+	// Latency is the duration of the last API call
+	Latency time.Duration
+}
+
+// Up reports if the last API call succeeded
+func (s Status) Up() bool {
+	return !s.LastSuccess.IsZero() && !s.LastSuccess.Before(s.LastErrorTime)
+}
+
+var (
+	statusMtx sync.Mutex
+	statuses  = map[string]*Status{}
+)
+
+// status returns the status of a cluster, creating it on first use. statusMtx must be held.
+func status(address string) *Status {
+	key := strings.ToLower(address)
+	s, ok := statuses[key]
+	if !ok {
+		s = &Status{Address: address}
+		statuses[key] = s
+	}
+	return s
+}
+
+// recordCall updates the status of a cluster with the outcome of an API call
+func recordCall(address string, latency time.Duration, err error) {
+	statusMtx.Lock()
+	defer statusMtx.Unlock()
+	s := status(address)
+	s.Latency = latency
+	if err != nil {
+		s.LastError, s.LastErrorTime = err.Error(), time.Now()
+	} else {
+		s.LastSuccess = time.Now()
+	}
+}
+
+// recordConnect updates the status of a cluster with its name and version
+func recordConnect(c *ISIClient) {
+	statusMtx.Lock()
+	defer statusMtx.Unlock()
+	s := status(c.ClusterAddress)
+	s.Name, s.Version = c.ClusterName, c.ISIVersion
+}
+
+// Statuses returns the status of every cluster the exporter talked to, sorted
+// by address.
+func Statuses() []Status {
+	statusMtx.Lock()
+	defer statusMtx.Unlock()
+	out := make([]Status, 0, len(statuses))
+	for _, s := range statuses {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
@@ -0,0 +1,197 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/internal/protowire"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Field numbers of the OTLP metrics protobuf messages, see
+// opentelemetry/proto/metrics/v1/metrics.proto and
+// opentelemetry/proto/collector/metrics/v1/metrics_service.proto
+const (
+	requestResourceMetrics = 1
+
+	resourceMetricsResource = 1
+	resourceMetricsScope    = 2
+	resourceAttributes      = 1
+
+	scopeMetricsScope   = 1
+	scopeMetricsMetrics = 2
+	scopeName           = 1
+
+	keyValueKey       = 1
+	keyValueValue     = 2
+	anyValueString    = 1
+	metricName        = 1
+	metricDescription = 2
+	metricGauge       = 5
+	metricSum         = 7
+	metricHistogram   = 9
+	metricSummary     = 11
+
+	dataPoints             = 1
+	aggregationTemporality = 2
+	sumIsMonotonic         = 3
+
+	pointStartTime = 2
+	pointTime      = 3
+
+	numberAsDouble   = 4
+	numberAttributes = 7
+
+	histogramCount          = 4
+	histogramSum            = 5
+	histogramBucketCounts   = 6
+	histogramExplicitBounds = 7
+	histogramAttributes     = 9
+
+	summaryCount          = 4
+	summarySum            = 5
+	summaryQuantileValues = 6
+	summaryAttributes     = 7
+	quantileQuantile      = 1
+	quantileValue         = 2
+)
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const aggregationCumulative = 2
+
+// scope is the instrumentation scope of every exported metric
+const scope = "github.com/paychex/prometheus-isilon-exporter"
+
+// encodeRequest encodes metric families as an ExportMetricsServiceRequest with
+// a single resource. Gauges and untyped metrics become gauges, counters
+// cumulative monotonic sums, and summaries and histograms keep their type.
+// Labels become data point attributes.
+func encodeRequest(resource map[string]string, families []*dto.MetricFamily, start, now int64) []byte {
+	res := proto.NewBuffer(nil)
+	for _, k := range sortedKeys(resource) {
+		protowire.EncodeBytes(res, resourceAttributes, encodeKeyValue(k, resource[k]))
+	}
+
+	sm := proto.NewBuffer(nil)
+	sc := proto.NewBuffer(nil)
+	protowire.EncodeString(sc, scopeName, scope)
+	protowire.EncodeBytes(sm, scopeMetricsScope, sc.Bytes())
+	for _, mf := range families {
+		protowire.EncodeBytes(sm, scopeMetricsMetrics, encodeMetric(mf, start, now))
+	}
+
+	rm := proto.NewBuffer(nil)
+	protowire.EncodeBytes(rm, resourceMetricsResource, res.Bytes())
+	protowire.EncodeBytes(rm, resourceMetricsScope, sm.Bytes())
+
+	req := proto.NewBuffer(nil)
+	protowire.EncodeBytes(req, requestResourceMetrics, rm.Bytes())
+	return req.Bytes()
+}
+
+// encodeMetric encodes a metric family as an OTLP Metric
+func encodeMetric(mf *dto.MetricFamily, start, now int64) []byte {
+	data := proto.NewBuffer(nil)
+	field := metricGauge
+	for _, m := range mf.Metric {
+		t := now
+		if m.TimestampMs != nil {
+			t = m.GetTimestampMs() * 1e6
+		}
+		p := proto.NewBuffer(nil)
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			field = metricSum
+			encodeNumberPoint(p, m, start, t, m.Counter.GetValue())
+		case dto.MetricType_GAUGE:
+			encodeNumberPoint(p, m, start, t, m.Gauge.GetValue())
+		case dto.MetricType_SUMMARY:
+			field = metricSummary
+			protowire.EncodeFixed64(p, pointStartTime, uint64(start))
+			protowire.EncodeFixed64(p, pointTime, uint64(t))
+			protowire.EncodeFixed64(p, summaryCount, m.Summary.GetSampleCount())
+			protowire.EncodeFixed64(p, summarySum, math.Float64bits(m.Summary.GetSampleSum()))
+			for _, q := range m.Summary.Quantile {
+				qb := proto.NewBuffer(nil)
+				protowire.EncodeFixed64(qb, quantileQuantile, math.Float64bits(q.GetQuantile()))
+				protowire.EncodeFixed64(qb, quantileValue, math.Float64bits(q.GetValue()))
+				protowire.EncodeBytes(p, summaryQuantileValues, qb.Bytes())
+			}
+			encodeAttributes(p, summaryAttributes, m.Label)
+		case dto.MetricType_HISTOGRAM:
+			field = metricHistogram
+			protowire.EncodeFixed64(p, pointStartTime, uint64(start))
+			protowire.EncodeFixed64(p, pointTime, uint64(t))
+			protowire.EncodeFixed64(p, histogramCount, m.Histogram.GetSampleCount())
+			protowire.EncodeFixed64(p, histogramSum, math.Float64bits(m.Histogram.GetSampleSum()))
+			// OTLP buckets are not cumulative and end with the +Inf bucket
+			counts, bounds := proto.NewBuffer(nil), proto.NewBuffer(nil)
+			var previous uint64
+			for _, b := range m.Histogram.Bucket {
+				counts.EncodeFixed64(b.GetCumulativeCount() - previous)
+				bounds.EncodeFixed64(math.Float64bits(b.GetUpperBound()))
+				previous = b.GetCumulativeCount()
+			}
+			counts.EncodeFixed64(m.Histogram.GetSampleCount() - previous)
+			protowire.EncodeBytes(p, histogramBucketCounts, counts.Bytes())
+			protowire.EncodeBytes(p, histogramExplicitBounds, bounds.Bytes())
+			encodeAttributes(p, histogramAttributes, m.Label)
+		default:
+			encodeNumberPoint(p, m, start, t, m.Untyped.GetValue())
+		}
+		protowire.EncodeBytes(data, dataPoints, p.Bytes())
+	}
+	switch field {
+	case metricSum:
+		protowire.EncodeVarint(data, aggregationTemporality, aggregationCumulative)
+		protowire.EncodeVarint(data, sumIsMonotonic, 1)
+	case metricHistogram:
+		protowire.EncodeVarint(data, aggregationTemporality, aggregationCumulative)
+	}
+
+	b := proto.NewBuffer(nil)
+	protowire.EncodeString(b, metricName, mf.GetName())
+	protowire.EncodeString(b, metricDescription, mf.GetHelp())
+	protowire.EncodeBytes(b, uint64(field), data.Bytes())
+	return b.Bytes()
+}
+
+// encodeNumberPoint appends the fields of a NumberDataPoint. Gauges get no start time.
+func encodeNumberPoint(p *proto.Buffer, m *dto.Metric, start, t int64, value float64) {
+	if m.Counter != nil {
+		protowire.EncodeFixed64(p, pointStartTime, uint64(start))
+	}
+	protowire.EncodeFixed64(p, pointTime, uint64(t))
+	protowire.EncodeFixed64(p, numberAsDouble, math.Float64bits(value))
+	encodeAttributes(p, numberAttributes, m.Label)
+}
+
+// encodeAttributes appends the labels as string attributes, leaving out empty labels
+func encodeAttributes(p *proto.Buffer, field uint64, labels []*dto.LabelPair) {
+	for _, l := range labels {
+		if l.GetValue() != "" {
+			protowire.EncodeBytes(p, field, encodeKeyValue(l.GetName(), l.GetValue()))
+		}
+	}
+}
+
+// encodeKeyValue encodes a KeyValue with a string value
+func encodeKeyValue(key, value string) []byte {
+	v := proto.NewBuffer(nil)
+	protowire.EncodeString(v, anyValueString, value)
+	kv := proto.NewBuffer(nil)
+	protowire.EncodeString(kv, keyValueKey, key)
+	protowire.EncodeBytes(kv, keyValueValue, v.Bytes())
+	return kv.Bytes()
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,192 @@
+package otlp
+
+import (
+	"reflect"
+	"testing"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/internal/protowire/protowiretest"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The messages below mirror opentelemetry/proto/metrics/v1/metrics.proto for
+// protowiretest. Oneofs are plain fields, which is the same on the wire.
+
+type exportRequest struct {
+	ResourceMetrics []*resourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics"`
+}
+
+type resourceMetrics struct {
+	Resource     *resource       `protobuf:"bytes,1,opt,name=resource"`
+	ScopeMetrics []*scopeMetrics `protobuf:"bytes,2,rep,name=scope_metrics"`
+}
+
+type resource struct {
+	Attributes []*keyValue `protobuf:"bytes,1,rep,name=attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   *instrumentationScope `protobuf:"bytes,1,opt,name=scope"`
+	Metrics []*metric             `protobuf:"bytes,2,rep,name=metrics"`
+}
+
+type instrumentationScope struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3"`
+}
+
+type keyValue struct {
+	Key   string    `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value *anyValue `protobuf:"bytes,2,opt,name=value"`
+}
+
+type anyValue struct {
+	StringValue string `protobuf:"bytes,1,opt,name=string_value,proto3"`
+}
+
+type metric struct {
+	Name        string     `protobuf:"bytes,1,opt,name=name,proto3"`
+	Description string     `protobuf:"bytes,2,opt,name=description,proto3"`
+	Gauge       *gauge     `protobuf:"bytes,5,opt,name=gauge"`
+	Sum         *sum       `protobuf:"bytes,7,opt,name=sum"`
+	Histogram   *histogram `protobuf:"bytes,9,opt,name=histogram"`
+	Summary     *summary   `protobuf:"bytes,11,opt,name=summary"`
+}
+
+type gauge struct {
+	DataPoints []*numberDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+}
+
+type sum struct {
+	DataPoints             []*numberDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+	AggregationTemporality int32              `protobuf:"varint,2,opt,name=aggregation_temporality,proto3"`
+	IsMonotonic            bool               `protobuf:"varint,3,opt,name=is_monotonic,proto3"`
+}
+
+type histogram struct {
+	DataPoints             []*histogramDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+	AggregationTemporality int32                 `protobuf:"varint,2,opt,name=aggregation_temporality,proto3"`
+}
+
+type summary struct {
+	DataPoints []*summaryDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+}
+
+type numberDataPoint struct {
+	StartTimeUnixNano uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,proto3"`
+	TimeUnixNano      uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,proto3"`
+	AsDouble          float64     `protobuf:"fixed64,4,opt,name=as_double,proto3"`
+	Attributes        []*keyValue `protobuf:"bytes,7,rep,name=attributes"`
+}
+
+type histogramDataPoint struct {
+	StartTimeUnixNano uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,proto3"`
+	TimeUnixNano      uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,proto3"`
+	Count             uint64      `protobuf:"fixed64,4,opt,name=count,proto3"`
+	Sum               float64     `protobuf:"fixed64,5,opt,name=sum,proto3"`
+	BucketCounts      []uint64    `protobuf:"fixed64,6,rep,packed,name=bucket_counts"`
+	ExplicitBounds    []float64   `protobuf:"fixed64,7,rep,packed,name=explicit_bounds"`
+	Attributes        []*keyValue `protobuf:"bytes,9,rep,name=attributes"`
+}
+
+type summaryDataPoint struct {
+	StartTimeUnixNano uint64             `protobuf:"fixed64,2,opt,name=start_time_unix_nano,proto3"`
+	TimeUnixNano      uint64             `protobuf:"fixed64,3,opt,name=time_unix_nano,proto3"`
+	Count             uint64             `protobuf:"fixed64,4,opt,name=count,proto3"`
+	Sum               float64            `protobuf:"fixed64,5,opt,name=sum,proto3"`
+	QuantileValues    []*valueAtQuantile `protobuf:"bytes,6,rep,name=quantile_values"`
+	Attributes        []*keyValue        `protobuf:"bytes,7,rep,name=attributes"`
+}
+
+type valueAtQuantile struct {
+	Quantile float64 `protobuf:"fixed64,1,opt,name=quantile,proto3"`
+	Value    float64 `protobuf:"fixed64,2,opt,name=value,proto3"`
+}
+
+// attr returns a string attribute
+func attr(key, value string) *keyValue {
+	return &keyValue{Key: key, Value: &anyValue{StringValue: value}}
+}
+
+// testFamilies returns a metric family of every type, with a cluster label
+// and an empty label that is left out
+func testFamilies() []*dto.MetricFamily {
+	labels := []*dto.LabelPair{
+		{Name: proto.String("clustername"), Value: proto.String("isi01")},
+		{Name: proto.String("node"), Value: proto.String("")},
+	}
+	return []*dto.MetricFamily{
+		{
+			Name: proto.String("emcisi_cluster_ifs_bytes_avail"), Help: proto.String("Bytes available."), Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(800)}}},
+		},
+		{
+			Name: proto.String("emcisi_node_net_bytes_in_total"), Help: proto.String("Bytes received."), Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Counter: &dto.Counter{Value: proto.Float64(1234)}, TimestampMs: proto.Int64(1500000000000)}},
+		},
+		{
+			Name: proto.String("emcisi_up"), Type: dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Untyped: &dto.Untyped{Value: proto.Float64(1)}}},
+		},
+		{
+			Name: proto.String("emcisi_api_latency_seconds"), Help: proto.String("API latency."), Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Summary: &dto.Summary{
+				SampleCount: proto.Uint64(10), SampleSum: proto.Float64(2.5),
+				Quantile: []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(0.2)}, {Quantile: proto.Float64(0.9), Value: proto.Float64(0.6)}},
+			}}},
+		},
+		{
+			Name: proto.String("emcisi_api_request_duration_seconds"), Help: proto.String("API request duration."), Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(7), SampleSum: proto.Float64(3.5),
+				Bucket: []*dto.Bucket{{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(2)}, {UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(5)}},
+			}}},
+		},
+	}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	const start, now = 1400000000000000000, 1600000000000000000
+	body := encodeRequest(map[string]string{"service.name": "isi01", "onefs.version": "8.1.0"}, testFamilies(), start, now)
+
+	var got exportRequest
+	if err := protowiretest.Unmarshal(body, &got); err != nil {
+		t.Fatalf("unable to decode the request: %s", err)
+	}
+	cluster := []*keyValue{attr("clustername", "isi01")}
+	want := exportRequest{ResourceMetrics: []*resourceMetrics{{
+		Resource: &resource{Attributes: []*keyValue{attr("onefs.version", "8.1.0"), attr("service.name", "isi01")}},
+		ScopeMetrics: []*scopeMetrics{{
+			Scope: &instrumentationScope{Name: scope},
+			Metrics: []*metric{
+				{Name: "emcisi_cluster_ifs_bytes_avail", Description: "Bytes available.", Gauge: &gauge{DataPoints: []*numberDataPoint{
+					{TimeUnixNano: now, AsDouble: 800, Attributes: cluster},
+				}}},
+				{Name: "emcisi_node_net_bytes_in_total", Description: "Bytes received.", Sum: &sum{
+					DataPoints: []*numberDataPoint{
+						{StartTimeUnixNano: start, TimeUnixNano: 1500000000000000000, AsDouble: 1234, Attributes: cluster},
+					},
+					AggregationTemporality: aggregationCumulative, IsMonotonic: true,
+				}},
+				{Name: "emcisi_up", Gauge: &gauge{DataPoints: []*numberDataPoint{
+					{TimeUnixNano: now, AsDouble: 1, Attributes: cluster},
+				}}},
+				{Name: "emcisi_api_latency_seconds", Description: "API latency.", Summary: &summary{DataPoints: []*summaryDataPoint{{
+					StartTimeUnixNano: start, TimeUnixNano: now, Count: 10, Sum: 2.5,
+					QuantileValues: []*valueAtQuantile{{Quantile: 0.5, Value: 0.2}, {Quantile: 0.9, Value: 0.6}},
+					Attributes:     cluster,
+				}}}},
+				{Name: "emcisi_api_request_duration_seconds", Description: "API request duration.", Histogram: &histogram{
+					DataPoints: []*histogramDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: now, Count: 7, Sum: 3.5,
+						BucketCounts: []uint64{2, 3, 2}, ExplicitBounds: []float64{0.1, 1},
+						Attributes: cluster,
+					}},
+					AggregationTemporality: aggregationCumulative,
+				}},
+			},
+		}},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded request\n%s\nwant\n%s", protowiretest.String(got), protowiretest.String(want))
+	}
+}
@@ -0,0 +1,233 @@
+// Package otlp periodically collects the metrics of Isilon clusters and exports
+// them to an OpenTelemetry collector over OTLP, with the cluster name, GUID and
+// OneFS version as resource attributes.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	// defaultTimeout is the timeout of an export when the configuration sets none
+	defaultTimeout = 30 * time.Second
+	// grpcMethod is the path of the OTLP metrics export call
+	grpcMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	// serviceName is the service.name resource attribute
+	serviceName = "prometheus-isilon-exporter"
+)
+
+// GathererFunc returns the gatherer collecting the metrics of a connected cluster
+type GathererFunc func(c *isiclient.ISIClient) (prometheus.Gatherer, error)
+
+// Exporter exports the metrics of a set of clusters every interval
+type Exporter struct {
+	// Config holds the collector endpoint
+	Config isiconfig.OTLPConfig
+	// Targets are the addresses of the clusters to export
+	Targets []string
+	// Credentials are used to connect to the clusters
+	Credentials isiclient.Credentials
+	// Gatherer creates the gatherer of a connected cluster
+	Gatherer GathererFunc
+	// HTTPClient is used to talk to the collector. Its transport must support
+	// HTTP/2 for grpc.
+	HTTPClient *http.Client
+
+	// start is the start time of the cumulative metrics
+	start   time.Time
+	mtx     sync.Mutex
+	targets map[string]*target
+}
+
+// target is a connected cluster
+type target struct {
+	client   *isiclient.ISIClient
+	gatherer prometheus.Gatherer
+}
+
+// New returns an Exporter for the given cluster addresses.
+func New(cfg isiconfig.OTLPConfig, targets []string, creds isiclient.Credentials, gatherer GathererFunc) *Exporter {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &Exporter{
+		Config:      cfg,
+		Targets:     targets,
+		Credentials: creds,
+		Gatherer:    gatherer,
+		// Leaving the TLS and dial settings alone keeps HTTP/2 enabled for grpc
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSHandshakeTimeout: 10 * time.Second},
+			Timeout:   timeout,
+		},
+		start:   time.Now(),
+		targets: map[string]*target{},
+	}
+}
+
+// Run exports the metrics of every cluster every interval until ctx is cancelled.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Config.Interval)
+	defer ticker.Stop()
+	defer e.close()
+	for {
+		for _, t := range e.Targets {
+			if err := e.Export(t); err != nil {
+				log.Infof("Unable to export the metrics of %s over OTLP: %s", t, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export collects the metrics of one cluster and sends them to the collector.
+func (e *Exporter) Export(address string) error {
+	t, err := e.target(address)
+	if err != nil {
+		return err
+	}
+	families, err := t.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	resource := map[string]string{
+		"service.name":         serviceName,
+		"isilon.cluster.name":  t.client.ClusterName,
+		"isilon.cluster.guid":  t.client.ClusterGUID,
+		"isilon.onefs.version": t.client.ISIVersion,
+	}
+	body := encodeRequest(resource, families, e.start.UnixNano(), time.Now().UnixNano())
+	if e.Config.Protocol == isiconfig.OTLPProtocolGRPC {
+		err = e.sendGRPC(body)
+	} else {
+		err = e.sendHTTP(body)
+	}
+	if err != nil {
+		return err
+	}
+	log.Debugf("Exported %d metric families of %s over OTLP", len(families), t.client.ClusterName)
+	return nil
+}
+
+// close closes the clients of the connected clusters
+func (e *Exporter) close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for address, t := range e.targets {
+		t.client.Close()
+		delete(e.targets, address)
+	}
+}
+
+// target returns the connected cluster, connecting on first use
+func (e *Exporter) target(address string) (*target, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if t, ok := e.targets[address]; ok {
+		return t, nil
+	}
+	c, err := isiclient.NewIsiClient(e.Credentials, address)
+	if err != nil {
+		return nil, err
+	}
+	g, err := e.Gatherer(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	t := &target{client: c, gatherer: g}
+	e.targets[address] = t
+	return t, nil
+}
+
+// sendHTTP exports a request with OTLP/HTTP in the binary protobuf encoding
+func (e *Exporter) sendHTTP(body []byte) error {
+	u, err := url.Parse(e.Config.Endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	resp, err := e.post(u.String(), "application/x-protobuf", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sendGRPC exports a request with an OTLP/gRPC unary call
+func (e *Exporter) sendGRPC(body []byte) error {
+	u, err := url.Parse(e.Config.Endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = grpcMethod
+
+	// A gRPC message is prefixed by a compression flag and its length
+	msg := make([]byte, 5+len(body))
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(body)))
+	copy(msg[5:], body)
+	resp, err := e.post(u.String(), "application/grpc", msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		return fmt.Errorf("grpc needs HTTP/2, got %s", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// The status is sent in the trailers, or in the headers of responses without a body
+	io.Copy(ioutil.Discard, resp.Body)
+	status, message := resp.Trailer.Get("grpc-status"), resp.Trailer.Get("grpc-message")
+	if status == "" {
+		status, message = resp.Header.Get("grpc-status"), resp.Header.Get("grpc-message")
+	}
+	if status != "0" {
+		return fmt.Errorf("grpc status %s: %s", status, message)
+	}
+	return nil
+}
+
+// post sends a request body with the configured headers
+func (e *Exporter) post(u, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.Config.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if contentType == "application/grpc" {
+		req.Header.Set("TE", "trailers")
+	}
+	return e.HTTPClient.Do(req)
+}
@@ -0,0 +1,225 @@
+// Package poller collects the metrics of Isilon clusters in the background,
+// each collector on its own interval, and serves the latest results so scrapes
+// never wait on the cluster.
+package poller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paychex/prometheus-isilon-exporter/pkg/collector"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/isiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// retryInterval is the time between two attempts to connect to a cluster
+const retryInterval = time.Minute
+
+var (
+	lastCollection = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "", "last_collection_timestamp_seconds"),
+		"Unix time the collector last finished polling the cluster.",
+		[]string{"clustername", "collector"}, nil,
+	)
+	collectionAge = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "collection", "age_seconds"),
+		"Seconds since the collector last finished polling the cluster.",
+		[]string{"clustername", "collector"}, nil,
+	)
+	collectionStale = prometheus.NewDesc(
+		prometheus.BuildFQName("emcisi", "collection", "stale"),
+		"Indicates if the results of the collector are older than twice its polling interval (1) or not (0).",
+		[]string{"clustername", "collector"}, nil,
+	)
+)
+
+// Collector is a collector of a cluster polled on its own interval
+type Collector struct {
+	Name      string
+	Collector prometheus.Collector
+	Interval  time.Duration
+}
+
+// CollectorsFunc returns the collectors of a connected cluster
+type CollectorsFunc func(c *isiclient.ISIClient) ([]Collector, error)
+
+// Poller polls a set of clusters in the background
+type Poller struct {
+	// Credentials are used to connect to the clusters
+	Credentials isiclient.Credentials
+	// Collectors creates the collectors of each cluster once it is connected
+	Collectors CollectorsFunc
+
+	targets map[string]*target
+}
+
+// target holds the state of a single polled cluster
+type target struct {
+	address string
+
+	mtx         sync.RWMutex
+	clusterName string
+	snapshots   []*snapshot
+}
+
+// snapshot holds the results of the last poll of a collector
+type snapshot struct {
+	Collector
+	metrics   []prometheus.Metric
+	collected time.Time
+}
+
+// New returns a Poller for the given cluster addresses.
+func New(targets []string, creds isiclient.Credentials, collectors CollectorsFunc) *Poller {
+	p := &Poller{
+		Credentials: creds,
+		Collectors:  collectors,
+		targets:     map[string]*target{},
+	}
+	for _, t := range targets {
+		p.targets[strings.ToLower(t)] = &target{address: t, clusterName: t}
+	}
+	return p
+}
+
+// Run connects to every cluster and polls its collectors until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range p.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			p.run(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// run connects to a cluster, retrying until it succeeds, and then polls each of
+// its collectors on their own interval.
+func (p *Poller) run(ctx context.Context, t *target) {
+	var collectors []Collector
+	for {
+		c, err := isiclient.NewIsiClient(p.Credentials, t.address)
+		if err == nil {
+			if collectors, err = p.Collectors(c); err != nil {
+				c.Close()
+			}
+		}
+		if err == nil {
+			defer c.Close()
+			t.mtx.Lock()
+			t.clusterName = c.ClusterName
+			t.mtx.Unlock()
+			break
+		}
+		log.Infof("Unable to connect to Isilon cluster %s, retrying in %s: %s", t.address, retryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range collectors {
+		s := &snapshot{Collector: c}
+		t.mtx.Lock()
+		t.snapshots = append(t.snapshots, s)
+		t.mtx.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.poll(ctx, s)
+		}()
+	}
+	wg.Wait()
+}
+
+// poll collects the metrics of a collector every interval
+func (t *target) poll(ctx context.Context, s *snapshot) {
+	log.Debugf("Polling %s collector of %s every %s", s.Name, t.address, s.Interval)
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		ch := make(chan prometheus.Metric)
+		done := make(chan []prometheus.Metric)
+		go func() {
+			var metrics []prometheus.Metric
+			for m := range ch {
+				metrics = append(metrics, m)
+			}
+			done <- metrics
+		}()
+		s.Collector.Collector.Collect(ch)
+		close(ch)
+		metrics := <-done
+
+		t.mtx.Lock()
+		s.metrics = metrics
+		s.collected = time.Now()
+		t.mtx.Unlock()
+		log.Debugf("Polled %s collector of %s in %s", s.Name, t.address, time.Since(start))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collector returns a prometheus.Collector serving the latest results of the
+// cluster at address, or nil if the cluster is not polled.
+func (p *Poller) Collector(address string) prometheus.Collector {
+	t, ok := p.targets[strings.ToLower(address)]
+	if !ok {
+		return nil
+	}
+	return t
+}
+
+// Collect delivers the metrics of the last poll of every collector along with
+// their age. It implements prometheus.Collector.
+func (t *target) Collect(ch chan<- prometheus.Metric) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	if t.snapshots == nil {
+		ch <- prometheus.MustNewConstMetric(collector.ExporterUp, prometheus.GaugeValue, 0, t.clusterName)
+		return
+	}
+	now := time.Now()
+	for _, s := range t.snapshots {
+		for _, m := range s.metrics {
+			ch <- m
+		}
+		if s.collected.IsZero() {
+			ch <- prometheus.MustNewConstMetric(collectionStale, prometheus.GaugeValue, 1, t.clusterName, s.Name)
+			continue
+		}
+		age := now.Sub(s.collected)
+		stale := 0.0
+		if age > 2*s.Interval {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(lastCollection, prometheus.GaugeValue, float64(s.collected.UnixNano())/1e9, t.clusterName, s.Name)
+		ch <- prometheus.MustNewConstMetric(collectionAge, prometheus.GaugeValue, age.Seconds(), t.clusterName, s.Name)
+		ch <- prometheus.MustNewConstMetric(collectionStale, prometheus.GaugeValue, stale, t.clusterName, s.Name)
+	}
+}
+
+// Describe describes the metrics added by the poller. The polled metrics
+// themselves are described by their collectors.
+// It implements prometheus.Collector.
+func (t *target) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastCollection
+	ch <- collectionAge
+	ch <- collectionStale
+	ch <- collector.ExporterUp
+}
@@ -0,0 +1,205 @@
+// Package push periodically collects the metrics of Isilon clusters and pushes
+// them to a Pushgateway, a Prometheus remote_write endpoint or an InfluxDB, for
+// clusters in network zones Prometheus can not scrape.
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/influx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// defaultTimeout is the timeout of a push when the endpoint sets none
+const defaultTimeout = 30 * time.Second
+
+// GathererFunc returns the gatherer collecting the metrics of a cluster
+type GathererFunc func(target string) (prometheus.Gatherer, error)
+
+// Pusher collects a set of clusters every interval and pushes their metrics
+type Pusher struct {
+	// Config holds the endpoints to push to
+	Config isiconfig.PushConfig
+	// Targets are the addresses of the clusters to push
+	Targets []string
+	// Gatherer creates the gatherer of a cluster. It is called again on the
+	// next push until it succeeds.
+	Gatherer GathererFunc
+
+	mtx       sync.Mutex
+	gatherers map[string]prometheus.Gatherer
+}
+
+// New returns a Pusher for the given cluster addresses.
+func New(cfg isiconfig.PushConfig, targets []string, gatherer GathererFunc) *Pusher {
+	return &Pusher{
+		Config:    cfg,
+		Targets:   targets,
+		Gatherer:  gatherer,
+		gatherers: map[string]prometheus.Gatherer{},
+	}
+}
+
+// Run pushes the metrics of every cluster every interval until ctx is cancelled.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Config.Interval)
+	defer ticker.Stop()
+	for {
+		for _, target := range p.Targets {
+			if err := p.Push(target); err != nil {
+				log.Infof("Unable to push the metrics of %s: %s", target, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push collects the metrics of one cluster and pushes them to every endpoint.
+func (p *Pusher) Push(target string) error {
+	g, err := p.gatherer(target)
+	if err != nil {
+		return err
+	}
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	cluster := clusterName(families, target)
+
+	var errs []string
+	if e := p.Config.Pushgateway; e != nil {
+		if err := pushgateway(e, p.Config.Job, cluster, families); err != nil {
+			errs = append(errs, "pushgateway: "+err.Error())
+		} else {
+			log.Debugf("Pushed %d metric families of %s to the Pushgateway", len(families), cluster)
+		}
+	}
+	if e := p.Config.RemoteWrite; e != nil {
+		if err := remoteWrite(e, p.Config.Job, families, time.Now()); err != nil {
+			errs = append(errs, "remote_write: "+err.Error())
+		} else {
+			log.Debugf("Sent %d metric families of %s to remote_write", len(families), cluster)
+		}
+	}
+	if e := p.Config.InfluxDB; e != nil {
+		if err := influxDB(e, families, time.Now()); err != nil {
+			errs = append(errs, "influxdb: "+err.Error())
+		} else {
+			log.Debugf("Wrote %d metric families of %s to InfluxDB", len(families), cluster)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// gatherer returns the cached gatherer of a cluster, creating it when missing
+func (p *Pusher) gatherer(target string) (prometheus.Gatherer, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if g, ok := p.gatherers[target]; ok {
+		return g, nil
+	}
+	g, err := p.Gatherer(target)
+	if err != nil {
+		return nil, err
+	}
+	p.gatherers[target] = g
+	return g, nil
+}
+
+// clusterName returns the clustername label of the collected metrics, or the
+// address of the cluster when there is none.
+func clusterName(families []*dto.MetricFamily, target string) string {
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "clustername" && l.GetValue() != "" {
+					return l.GetValue()
+				}
+			}
+		}
+	}
+	return target
+}
+
+// pushgateway replaces the group of the cluster on a Pushgateway with the
+// collected metrics.
+func pushgateway(e *isiconfig.PushEndpoint, job, cluster string, families []*dto.MetricFamily) error {
+	buf := &bytes.Buffer{}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(buf, mf); err != nil {
+			return err
+		}
+	}
+	u := strings.TrimSuffix(e.URL, "/") + "/metrics/job/" + url.PathEscape(job) + "/clustername/" + url.PathEscape(cluster)
+	return send(e, http.MethodPut, u, buf, map[string]string{"Content-Type": string(expfmt.FmtText)})
+}
+
+// influxDB writes the collected metrics as line protocol to an InfluxDB v2.
+func influxDB(e *isiconfig.InfluxDBEndpoint, families []*dto.MetricFamily, now time.Time) error {
+	buf := &bytes.Buffer{}
+	if err := influx.Write(buf, families, now); err != nil {
+		return err
+	}
+	args := url.Values{"bucket": []string{e.Bucket}, "precision": []string{"ns"}}
+	if e.Org != "" {
+		args.Set("org", e.Org)
+	}
+	header := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	if e.Token != "" {
+		header["Authorization"] = "Token " + e.Token
+	}
+	u := strings.TrimSuffix(e.URL, "/") + "/api/v2/write?" + args.Encode()
+	return send(&e.PushEndpoint, http.MethodPost, u, buf, header)
+}
+
+// send makes an authenticated request to an endpoint and checks its response
+func send(e *isiconfig.PushEndpoint, method, u string, body io.Reader, header map[string]string) error {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if e.BasicAuth != nil {
+		req.SetBasicAuth(e.BasicAuth.Username, e.BasicAuth.Password)
+	}
+	if e.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.BearerToken)
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
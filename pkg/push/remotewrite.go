@@ -0,0 +1,129 @@
+package push
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	isiconfig "github.com/paychex/prometheus-isilon-exporter/pkg/config"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/internal/protowire"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Field numbers of the remote_write protobuf messages, see prompb/remote.proto
+// and prompb/types.proto in the Prometheus repository
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+// label is a label of a remote_write time series
+type label struct {
+	name, value string
+}
+
+// timeSeries is a remote_write time series with a single sample
+type timeSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// remoteWrite sends the collected metrics to a Prometheus remote_write endpoint.
+func remoteWrite(e *isiconfig.PushEndpoint, job string, families []*dto.MetricFamily, now time.Time) error {
+	body := snappy.Encode(nil, encodeWriteRequest(toTimeSeries(families, job, now)))
+	return send(e, "POST", e.URL, bytes.NewReader(body), map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+// toTimeSeries flattens metric families into time series the way Prometheus
+// stores them: summaries and histograms become their _sum, _count and
+// quantile or _bucket series. Every series gets the job label unless it has
+// one, empty labels are dropped and samples without a timestamp are taken at now.
+func toTimeSeries(families []*dto.MetricFamily, job string, now time.Time) []timeSeries {
+	var series []timeSeries
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			ts := now.UnixNano() / int64(time.Millisecond)
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...label) {
+				labels := []label{{"__name__", name}}
+				hasJob := false
+				for _, l := range m.Label {
+					// Prometheus treats empty labels as missing
+					if l.GetValue() == "" {
+						continue
+					}
+					labels = append(labels, label{l.GetName(), l.GetValue()})
+					hasJob = hasJob || l.GetName() == "job"
+				}
+				if !hasJob {
+					labels = append(labels, label{"job", job})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				series = append(series, timeSeries{labels: labels, value: value, timestamp: ts})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.Counter.GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.Gauge.GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.Summary.Quantile {
+					add(name, q.GetValue(), label{"quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)})
+				}
+				add(name+"_sum", m.Summary.GetSampleSum())
+				add(name+"_count", float64(m.Summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				for _, b := range m.Histogram.Bucket {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), label{"le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)})
+				}
+				add(name+"_bucket", float64(m.Histogram.GetSampleCount()), label{"le", "+Inf"})
+				add(name+"_sum", m.Histogram.GetSampleSum())
+				add(name+"_count", float64(m.Histogram.GetSampleCount()))
+			default:
+				add(name, m.Untyped.GetValue())
+			}
+		}
+	}
+	return series
+}
+
+// encodeWriteRequest encodes the time series as a remote_write WriteRequest.
+// The messages are small enough to be encoded by hand instead of pulling in
+// the generated Prometheus protobuf code.
+func encodeWriteRequest(series []timeSeries) []byte {
+	req := proto.NewBuffer(nil)
+	for _, s := range series {
+		ts := proto.NewBuffer(nil)
+		for _, l := range s.labels {
+			lb := proto.NewBuffer(nil)
+			protowire.EncodeString(lb, labelName, l.name)
+			protowire.EncodeString(lb, labelValue, l.value)
+			protowire.EncodeBytes(ts, timeSeriesLabels, lb.Bytes())
+		}
+		sb := proto.NewBuffer(nil)
+		protowire.EncodeFixed64(sb, sampleValue, math.Float64bits(s.value))
+		protowire.EncodeVarint(sb, sampleTimestamp, uint64(s.timestamp))
+		protowire.EncodeBytes(ts, timeSeriesSamples, sb.Bytes())
+		protowire.EncodeBytes(req, writeRequestTimeseries, ts.Bytes())
+	}
+	return req.Bytes()
+}
@@ -0,0 +1,103 @@
+package push
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/paychex/prometheus-isilon-exporter/pkg/internal/protowire/protowiretest"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The messages below mirror prompb/remote.proto and prompb/types.proto of the
+// Prometheus repository for protowiretest.
+
+type writeRequest struct {
+	Timeseries []*promTimeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+type promTimeSeries struct {
+	Labels  []*promLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*promSample `protobuf:"bytes,2,rep,name=samples"`
+}
+
+type promLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+type promSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+// series returns a decoded time series with a single sample, the labels
+// given as name and value pairs
+func series(value float64, timestamp int64, labels ...string) *promTimeSeries {
+	ts := &promTimeSeries{Samples: []*promSample{{Value: value, Timestamp: timestamp}}}
+	for i := 0; i < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &promLabel{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	labels := []*dto.LabelPair{
+		{Name: proto.String("clustername"), Value: proto.String("isi01")},
+		{Name: proto.String("node"), Value: proto.String("")},
+	}
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("emcisi_cluster_ifs_bytes_avail"), Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(800)}}},
+		},
+		{
+			Name: proto.String("emcisi_node_net_bytes_in_total"), Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Counter: &dto.Counter{Value: proto.Float64(1234)}, TimestampMs: proto.Int64(1500000000000)}},
+		},
+		{
+			Name: proto.String("emcisi_up"), Type: dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{
+				Label:   append(labels, &dto.LabelPair{Name: proto.String("job"), Value: proto.String("isilon")}),
+				Untyped: &dto.Untyped{Value: proto.Float64(1)},
+			}},
+		},
+		{
+			Name: proto.String("emcisi_api_latency_seconds"), Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Summary: &dto.Summary{
+				SampleCount: proto.Uint64(10), SampleSum: proto.Float64(2.5),
+				Quantile: []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(0.2)}},
+			}}},
+		},
+		{
+			Name: proto.String("emcisi_api_request_duration_seconds"), Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Label: labels, Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(7), SampleSum: proto.Float64(3.5),
+				Bucket: []*dto.Bucket{{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(2)}},
+			}}},
+		},
+	}
+	now := time.Unix(1600000000, 0)
+	const ms = 1600000000000
+
+	var got writeRequest
+	if err := protowiretest.Unmarshal(encodeWriteRequest(toTimeSeries(families, "exporter", now)), &got); err != nil {
+		t.Fatalf("unable to decode the request: %s", err)
+	}
+	want := writeRequest{Timeseries: []*promTimeSeries{
+		series(800, ms, "__name__", "emcisi_cluster_ifs_bytes_avail", "clustername", "isi01", "job", "exporter"),
+		series(1234, 1500000000000, "__name__", "emcisi_node_net_bytes_in_total", "clustername", "isi01", "job", "exporter"),
+		series(1, ms, "__name__", "emcisi_up", "clustername", "isi01", "job", "isilon"),
+		series(0.2, ms, "__name__", "emcisi_api_latency_seconds", "clustername", "isi01", "job", "exporter", "quantile", "0.5"),
+		series(2.5, ms, "__name__", "emcisi_api_latency_seconds_sum", "clustername", "isi01", "job", "exporter"),
+		series(10, ms, "__name__", "emcisi_api_latency_seconds_count", "clustername", "isi01", "job", "exporter"),
+		series(2, ms, "__name__", "emcisi_api_request_duration_seconds_bucket", "clustername", "isi01", "job", "exporter", "le", "0.1"),
+		series(7, ms, "__name__", "emcisi_api_request_duration_seconds_bucket", "clustername", "isi01", "job", "exporter", "le", "+Inf"),
+		series(3.5, ms, "__name__", "emcisi_api_request_duration_seconds_sum", "clustername", "isi01", "job", "exporter"),
+		series(7, ms, "__name__", "emcisi_api_request_duration_seconds_count", "clustername", "isi01", "job", "exporter"),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded request\n%s\nwant\n%s", protowiretest.String(got), protowiretest.String(want))
+	}
+}
@@ -0,0 +1,252 @@
+// Package web serves the exporter's HTTP endpoints with optional TLS, client
+// certificate verification and basic authentication, configured with a web
+// configuration file in the format of the Prometheus exporter toolkit.
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the layout of the web configuration file
+type Config struct {
+	TLSConfig TLSConfig `yaml:"tls_server_config"`
+	// Users maps user names to bcrypt hashes of their passwords. Every request
+	// needs basic authentication when set.
+	Users map[string]string `yaml:"basic_auth_users"`
+}
+
+// TLSConfig holds the TLS settings of the server
+type TLSConfig struct {
+	// CertFile and KeyFile hold the server certificate. They are read again
+	// when they change, so certificates can be renewed without a restart.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuth is one of NoClientCert (the default), RequestClientCert,
+	// RequireAnyClientCert, VerifyClientCertIfGiven and RequireAndVerifyClientCert
+	ClientAuth string `yaml:"client_auth_type"`
+	// ClientCAs is the file with the CA certificates client certificates are verified against
+	ClientCAs string `yaml:"client_ca_file"`
+	// MinVersion and MaxVersion limit the TLS versions, e.g. TLS12
+	MinVersion string `yaml:"min_version"`
+	MaxVersion string `yaml:"max_version"`
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// LoadConfig reads and checks a web configuration file.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	for user, hash := range cfg.Users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("parsing %s: password of %s is not a bcrypt hash: %s", filename, user, err)
+		}
+	}
+	if _, err := cfg.TLSConfig.tlsConfig(); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	return cfg, nil
+}
+
+// Enabled reports if the server uses TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// tlsConfig returns the server TLS configuration, or nil without TLS
+func (t TLSConfig) tlsConfig() (*tls.Config, error) {
+	if !t.Enabled() {
+		if t.ClientAuth != "" || t.ClientCAs != "" {
+			return nil, fmt.Errorf("client certificates need cert_file and key_file")
+		}
+		return nil, nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, fmt.Errorf("TLS needs both cert_file and key_file")
+	}
+	certs := &certificate{certFile: t.CertFile, keyFile: t.KeyFile}
+	if _, err := certs.get(nil); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{GetCertificate: certs.get}
+
+	auth, ok := clientAuthTypes[t.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unknown client_auth_type %q", t.ClientAuth)
+	}
+	cfg.ClientAuth = auth
+	if t.ClientCAs != "" {
+		pem, err := ioutil.ReadFile(t.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.ClientCAs)
+		}
+	} else if auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_auth_type %s needs a client_ca_file", t.ClientAuth)
+	}
+
+	for _, v := range []struct {
+		name string
+		dst  *uint16
+	}{{t.MinVersion, &cfg.MinVersion}, {t.MaxVersion, &cfg.MaxVersion}} {
+		if v.name == "" {
+			continue
+		}
+		version, ok := tlsVersions[v.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q, must be TLS10, TLS11, TLS12 or TLS13", v.name)
+		}
+		*v.dst = version
+	}
+	return cfg, nil
+}
+
+// certificate loads a certificate and reloads it when its files change
+type certificate struct {
+	certFile, keyFile string
+
+	mtx      sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// get returns the certificate, reading it again when a file changed since it
+// was last read. A certificate that fails to reload is logged and the previous
+// one kept. It implements tls.Config.GetCertificate.
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var modified time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			if c.cert != nil {
+				log.Infof("Unable to check TLS certificate %s, keeping the loaded one: %s", f, err)
+				return c.cert, nil
+			}
+			return nil, err
+		}
+		if fi.ModTime().After(modified) {
+			modified = fi.ModTime()
+		}
+	}
+	if c.cert != nil && !modified.After(c.modified) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			log.Infof("Unable to reload TLS certificate %s, keeping the loaded one: %s", c.certFile, err)
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		log.Infof("Reloaded TLS certificate %s", c.certFile)
+	}
+	c.cert, c.modified = &cert, modified
+	return c.cert, nil
+}
+
+// authHandler requires basic authentication of one of the users
+type authHandler struct {
+	users   map[string]string
+	handler http.Handler
+
+	mtx sync.Mutex
+	// verified caches successful password checks, bcrypt is slow on purpose
+	verified map[[sha256.Size]byte]bool
+}
+
+// dummyHash is compared against for unknown users, so they take as long as known ones
+const dummyHash = "$2a$10$kA7snG8lswwKewybqf95hOWtNGgJFf.P3J89N2BUIGwO2o7UuO8l."
+
+// ServeHTTP implements http.Handler.
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if ok {
+		hash, known := h.users[user]
+		if !known {
+			hash = dummyHash
+		}
+		key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + pass))
+
+		h.mtx.Lock()
+		cached := h.verified[key]
+		h.mtx.Unlock()
+		if !cached {
+			cached = bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil && known
+			if cached {
+				h.mtx.Lock()
+				h.verified[key] = true
+				h.mtx.Unlock()
+			}
+		}
+		if cached {
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Isilon Exporter"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// Handler wraps handler with the basic authentication of the configuration.
+func (cfg *Config) Handler(handler http.Handler) http.Handler {
+	if cfg == nil || len(cfg.Users) == 0 {
+		return handler
+	}
+	return &authHandler{users: cfg.Users, handler: handler, verified: map[[sha256.Size]byte]bool{}}
+}
+
+// ListenAndServe runs the server with the TLS and authentication of the
+// configuration, which may be nil for plain HTTP without authentication.
+func (cfg *Config) ListenAndServe(server *http.Server) error {
+	server.Handler = cfg.Handler(server.Handler)
+	if cfg == nil || !cfg.TLSConfig.Enabled() {
+		return server.ListenAndServe()
+	}
+	tlsConfig, err := cfg.TLSConfig.tlsConfig()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS("", "")
+}